@@ -0,0 +1,175 @@
+// Package config loads a pipeline definition (listen address, Log Store, datamodels, parser & syncer settings)
+// from a YAML, JSON or TOML file, so that the tool can run headless without calling the HTTP API
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mysql2mssql/server/param"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	validator "github.com/go-playground/validator/v10"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is a pipeline definition, the keys of datamodels, parser & syncer are the same as the JSON of the HTTP API.
+// Values can reference environment variables with `${NAME}`, to keep credentials out of the file
+//
+// Example:
+//
+//	listen: ":1323"
+//	store:
+//	  dir: /var/lib/mysql2mssql
+//	datamodels:
+//	  - table: staff
+//	    columns:
+//	      - {name: staff_id, type: 1, is_primary: true}
+//	      - {name: first_name, type: 5}
+//	parser:
+//	  server_id: 100
+//	  addr: 127.0.0.1:3306
+//	  user: root
+//	  password: ${MYSQL_PASSWORD}
+//	  use_decimal: true
+//	  include_table_regex: ["sakila\\.staff"]
+//	syncer:
+//	  server: 127.0.0.1
+//	  database: sakila
+type Config struct {
+	// Listen is the address of the HTTP API (default ":1323")
+	Listen string `json:"listen,omitempty"`
+	Store  Store  `json:"store,omitempty"`
+	// SecretKey encrypts the saved parser & syncer requests, see server.Options
+	SecretKey string `json:"secret_key,omitempty"`
+	Auth      Auth   `json:"auth,omitempty"`
+	// TLS serves the HTTP API over HTTPS, plain HTTP if not set
+	TLS *TLS `json:"tls,omitempty"`
+	// AutoResume restarts the last started parser & syncer, only applies if they're not defined in this file
+	AutoResume bool `json:"auto_resume,omitempty"`
+	// Discover generates & saves datamodels from source db's information_schema on startup, before Datamodels are put
+	Discover   *param.DiscoverStructRequest `json:"discover,omitempty"`
+	Datamodels []param.StructRequest        `json:"datamodels,omitempty" validate:"dive"`
+	Parser     *param.StartParserRequest    `json:"parser,omitempty"`
+	Syncer     *param.StartSyncerRequest    `json:"syncer,omitempty"`
+}
+
+// Auth lists the clients allowed to call the HTTP API, see server.Options.Auth; the API is open if empty
+type Auth struct {
+	// Tokens are static bearer tokens / API keys
+	Tokens []Token `json:"tokens,omitempty" validate:"dive"`
+	// ClientCerts are the common names of accepted TLS client certificates
+	ClientCerts []ClientCert `json:"client_certs,omitempty" validate:"dive"`
+}
+
+// Token is a static bearer token / API key
+type Token struct {
+	Token string `json:"token" validate:"required"`
+	// Role: "read" (GET endpoints only) or "admin"
+	Role string `json:"role" validate:"oneof=read admin"`
+}
+
+// ClientCert is an accepted TLS client certificate
+type ClientCert struct {
+	CommonName string `json:"common_name" validate:"required"`
+	// Role: "read" (GET endpoints only) or "admin"
+	Role string `json:"role" validate:"oneof=read admin"`
+}
+
+// TLS of the HTTP API listener, files are PEM encoded
+type TLS struct {
+	CertFile string `json:"cert_file" validate:"required"`
+	KeyFile  string `json:"key_file" validate:"required"`
+	// ClientCAFile enables mutual TLS, client certificates are verified against it (see Auth.ClientCerts)
+	ClientCAFile string `json:"client_ca_file,omitempty" validate:"required_with=RequireClientCert"`
+	// RequireClientCert rejects clients without a valid certificate, otherwise it is optional
+	RequireClientCert bool `json:"require_client_cert,omitempty"`
+}
+
+// Store is the Log Store settings
+type Store struct {
+	// Backend: "nutsdb" (Default) or "inmem", changes logged in memory are lost on exit
+	Backend string `json:"backend,omitempty" validate:"omitempty,oneof=nutsdb inmem"`
+	// Dir is the nutsdb directory (default "data")
+	Dir string `json:"dir,omitempty"`
+	// SegmentSize is the size of nutsdb data files in bytes (default 8MB), can't be changed after first run
+	SegmentSize int64 `json:"segment_size,omitempty" validate:"omitempty,min=1"`
+}
+
+const (
+	defaultListen      = ":1323"
+	defaultDir         = "data"
+	defaultSegmentSize = 8 * 1024 * 1024
+)
+
+var envRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Load reads & validates a config file, defaults are filled in.
+// The format is picked by file extension: TOML for ".toml", YAML (or JSON, which is valid YAML) otherwise
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b = envRegex.ReplaceAllFunc(b, func(ref []byte) []byte {
+		return []byte(os.Getenv(string(envRegex.FindSubmatch(ref)[1])))
+	})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		if b, err = tomlToJSON(b); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	cfg := &Config{}
+	if err = yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	cfg.setDefaults()
+	if err = cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// tomlToJSON converts TOML document `b` to JSON, so that it is decoded with the same keys & rules as YAML
+func tomlToJSON(b []byte) ([]byte, error) {
+	doc := map[string]interface{}{}
+	if _, err := toml.Decode(string(b), &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// Default returns the config of an empty pipeline, to be defined with the HTTP API
+func Default() *Config {
+	cfg := &Config{}
+	cfg.setDefaults()
+	return cfg
+}
+
+func (c *Config) setDefaults() {
+	if c.Listen == "" {
+		c.Listen = defaultListen
+	}
+	if c.Store.Dir == "" {
+		c.Store.Dir = defaultDir
+	}
+	if c.Store.SegmentSize == 0 {
+		c.Store.SegmentSize = defaultSegmentSize
+	}
+}
+
+// Validate checks the config with the same rules as the HTTP API requests
+func (c *Config) Validate() error {
+	if err := validator.New().Struct(c); err != nil {
+		return err
+	}
+	if c.Syncer != nil && c.Parser == nil {
+		return fmt.Errorf("syncer requires parser to be defined")
+	}
+	return nil
+}
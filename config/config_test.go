@@ -0,0 +1,112 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const pipelineYAML = `
+listen: ":8080"
+datamodels:
+  - table: staff
+    columns:
+      - {name: staff_id, type: 1, is_primary: true}
+      - {name: first_name, type: 5}
+parser:
+  server_id: 100
+  addr: 127.0.0.1:3306
+  user: root
+  password: ${CONFIG_TEST_PASSWORD}
+  use_decimal: true
+  include_table_regex: ["sakila\\.staff"]
+syncer:
+  server: 127.0.0.1
+  database: sakila
+  batch_size: 500
+`
+
+const pipelineTOML = `
+listen = ":8080"
+
+[[datamodels]]
+table = "staff"
+columns = [
+  {name = "staff_id", type = 1, is_primary = true},
+  {name = "first_name", type = 5},
+]
+
+[parser]
+server_id = 100
+addr = "127.0.0.1:3306"
+user = "root"
+password = "${CONFIG_TEST_PASSWORD}"
+use_decimal = true
+include_table_regex = ['sakila\.staff']
+
+[syncer]
+server = "127.0.0.1"
+database = "sakila"
+batch_size = 500
+`
+
+// writeConfig writes `content` to file `name` in a temporary directory, returns its path
+func writeConfig(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	os.Setenv("CONFIG_TEST_PASSWORD", "secret")
+	defer os.Unsetenv("CONFIG_TEST_PASSWORD")
+
+	for name, content := range map[string]string{"pipeline.yaml": pipelineYAML, "pipeline.toml": pipelineTOML} {
+		cfg, err := Load(writeConfig(t, name, content))
+		if err != nil {
+			t.Fatalf("%v - Load failed: %v", name, err)
+		}
+		if cfg.Listen != ":8080" || cfg.Store.Dir != defaultDir || cfg.Store.SegmentSize != defaultSegmentSize {
+			t.Errorf("%v - Load - Actual: %v %v", name, cfg.Listen, cfg.Store)
+		}
+		if len(cfg.Datamodels) != 1 || len(cfg.Datamodels[0].Columns) != 2 || !cfg.Datamodels[0].Columns[0].IsPrimary {
+			t.Errorf("%v - Load - Datamodels: %v", name, cfg.Datamodels)
+		}
+		if cfg.Parser.Password != "secret" || cfg.Parser.IncludeTableRegex[0] != `sakila\.staff` || cfg.Parser.ServerID != 100 {
+			t.Errorf("%v - Load - Parser: %v", name, cfg.Parser)
+		}
+		if cfg.Syncer.BatchSize != 500 {
+			t.Errorf("%v - Load - Syncer: %v", name, cfg.Syncer)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	// missing password
+	if _, err := Load(writeConfig(t, "pipeline.yaml", pipelineYAML)); err == nil {
+		t.Errorf("Expected validation error")
+	}
+	// unknown key
+	if _, err := Load(writeConfig(t, "pipeline.yaml", "listen: \":8080\"\nlisten_addr: \":8080\"")); err == nil {
+		t.Errorf("Expected unknown field error")
+	}
+	// unknown TOML key, invalid TOML
+	if _, err := Load(writeConfig(t, "pipeline.toml", "listen = \":8080\"\nlisten_addr = \":8080\"")); err == nil {
+		t.Errorf("Expected unknown field error")
+	}
+	if _, err := Load(writeConfig(t, "pipeline.toml", "listen: \":8080\"")); err == nil {
+		t.Errorf("Expected TOML syntax error")
+	}
+	// syncer without parser
+	if _, err := Load(writeConfig(t, "pipeline.yaml", "syncer:\n  server: 127.0.0.1\n  database: sakila")); err == nil {
+		t.Errorf("Expected error on syncer without parser")
+	}
+}
@@ -37,6 +37,35 @@ func (i inmemdb) GetAllKey(bucket string, key string) ([][]byte, error) {
 	return i.mockdb[bucket][key], nil
 }
 
+func (i inmemdb) GetRange(bucket string, key string, start int, end int) ([][]byte, error) {
+	i.initMap(bucket, key)
+	list := i.mockdb[bucket][key]
+	// negative indexes are offsets from the end of the list, same as nutsdb
+	if start < 0 {
+		start += len(list)
+	}
+	if end < 0 {
+		end += len(list)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= len(list) {
+		end = len(list) - 1
+	}
+	if start > end {
+		return [][]byte{}, nil
+	}
+	return list[start : end+1], nil
+}
+
+func (i inmemdb) Get(bucket string, key string) ([]byte, error) {
+	if len(i.mockdb[bucket][key]) == 0 {
+		return nil, nil
+	}
+	return i.mockdb[bucket][key][0], nil
+}
+
 func (i inmemdb) Put(bucket string, key string, value []byte, ttl uint32) error {
 	i.initMap(bucket, key)
 	if len(i.mockdb[bucket][key]) == 0 {
@@ -47,6 +76,11 @@ func (i inmemdb) Put(bucket string, key string, value []byte, ttl uint32) error
 	return nil
 }
 
+func (i inmemdb) Delete(bucket string, key string) error {
+	delete(i.mockdb[bucket], key)
+	return nil
+}
+
 func (i inmemdb) Push(bucket, key string, value []byte) error {
 	i.initMap(bucket, key)
 	i.mockdb[bucket][key] = append(i.mockdb[bucket][key], value)
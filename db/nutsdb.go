@@ -1,7 +1,10 @@
 package db
 
 import (
+	"strings"
+
 	"github.com/xujiajun/nutsdb"
+	"github.com/xujiajun/nutsdb/ds/list"
 )
 
 type localdb struct {
@@ -55,8 +58,20 @@ func (ldb localdb) GetAll(bucket string) (entries []*Entry, err error) {
 func (ldb localdb) GetAllKey(bucket string, key string) (list [][]byte, err error) {
 	err = ldb.View(func(tx *nutsdb.Tx) error {
 		list, err = tx.LRange(bucket, []byte(key), 0, -1)
-		// ignore empty bucket
-		if err != nil && err != nutsdb.ErrBucketEmpty {
+		// ignore empty or missing list
+		if err != nil && !isEmptyList(err) {
+			return err
+		}
+		return nil
+	})
+	return
+}
+
+func (ldb localdb) GetRange(bucket string, key string, start int, end int) (list [][]byte, err error) {
+	err = ldb.View(func(tx *nutsdb.Tx) error {
+		list, err = tx.LRange(bucket, []byte(key), start, end)
+		// ignore empty or missing list
+		if err != nil && !isEmptyList(err) {
 			return err
 		}
 		return nil
@@ -64,12 +79,41 @@ func (ldb localdb) GetAllKey(bucket string, key string) (list [][]byte, err erro
 	return
 }
 
+func (ldb localdb) Get(bucket string, key string) (value []byte, err error) {
+	err = ldb.View(func(tx *nutsdb.Tx) error {
+		e, err := tx.Get(bucket, []byte(key))
+		if err != nil {
+			// ignore missing key or bucket
+			if err == nutsdb.ErrKeyNotFound || err == nutsdb.ErrNotFoundKey || strings.HasPrefix(err.Error(), "not found bucket") {
+				return nil
+			}
+			return err
+		}
+		value = e.Value
+		return nil
+	})
+	return
+}
+
 func (ldb localdb) Put(bucket string, key string, value []byte, ttl uint32) error {
 	return ldb.Update(func(tx *nutsdb.Tx) error {
 		return tx.Put(bucket, []byte(key), value, ttl)
 	})
 }
 
+func (ldb localdb) Delete(bucket string, key string) error {
+	return ldb.Update(func(tx *nutsdb.Tx) error {
+		if err := tx.Delete(bucket, []byte(key)); err != nil {
+			// ignore missing key or bucket
+			if err == nutsdb.ErrKeyNotFound || err == nutsdb.ErrNotFoundKey || strings.HasPrefix(err.Error(), "not found bucket") {
+				return nil
+			}
+			return err
+		}
+		return nil
+	})
+}
+
 func (ldb localdb) Push(bucket string, key string, value []byte) error {
 	return ldb.Update(func(tx *nutsdb.Tx) error {
 		return tx.RPush(bucket, []byte(key), value)
@@ -83,9 +127,10 @@ func (ldb localdb) Rem(bucket string, key string, count int) (err error) {
 }
 
 func (ldb localdb) Size(bucket string, key string) (size int, err error) {
-	ldb.View(func(tx *nutsdb.Tx) error {
+	err = ldb.View(func(tx *nutsdb.Tx) error {
 		size, err = tx.LSize(bucket, []byte(key))
-		if err != nil {
+		// missing list has no element
+		if err != nil && !isEmptyList(err) {
 			return err
 		}
 		return nil
@@ -100,8 +145,8 @@ func (ldb localdb) Type() string {
 func (ldb localdb) Truncate(bucket string, key string) error {
 	return ldb.Update(func(tx *nutsdb.Tx) error {
 		if err := tx.LRem(bucket, []byte(key), 0); err != nil {
-			// ignore "the list not found" error
-			if err.Error() == "the list not found" || err.Error() == "err bucket" {
+			// ignore missing list
+			if isEmptyList(err) {
 				return nil
 			}
 			return err
@@ -109,3 +154,9 @@ func (ldb localdb) Truncate(bucket string, key string) error {
 		return nil
 	})
 }
+
+// isEmptyList reports whether `err` is returned by nutsdb list operations on a list that does not exist (yet):
+// its bucket is missing (no element has ever been pushed to it), its key is missing, or it is empty
+func isEmptyList(err error) bool {
+	return err == nutsdb.ErrBucket || err == nutsdb.ErrBucketEmpty || err == list.ErrListNotFound
+}
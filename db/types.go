@@ -1,6 +1,10 @@
 package db
 
 import (
+	"encoding/json"
+	"fmt"
+	"mysql2mssql/spatial"
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -21,16 +25,17 @@ const (
 	// Warning: don't use this type on mysql unsinged bigint, use NullableUInt intead
 	NullableInt
 
-	// UInt includes unsigned integer types including unsinged bigint; default is 0
+	// UInt includes unsigned integer types including unsinged bigint; default is 0.
+	// Values overflowing bigint are synced as decimal(21,0), see UInt8 to UInt64 for a mapping per width
 	UInt
 
 	// NullableUInt includes unsigned integer types including unsinged bigint; default is nil
 	NullableUInt
 
-	// String includes char, varchar, text, time, enum, also support blob, binary, varbinary; default value is ""
+	// String includes char, varchar, text, enum, also support blob, binary, varbinary; default value is ""
 	String
 
-	// NullableString includes char, varchar, text, time, enum, also support blob, binary, varbinary; default value is nil
+	// NullableString includes char, varchar, text, enum, also support blob, binary, varbinary; default value is nil
 	NullableString
 
 	// Bool includes tinyint (1 bit) type; default to false
@@ -74,6 +79,70 @@ const (
 
 	// NullableSet includes set; default to nil
 	NullableSet
+
+	// Time includes time, mapped to Go's time.Duration (negative & over 24 hours values included),
+	// synced to MSSQL varchar as "[-]hh:mm:ss.ffffff"; default to 0
+	Time
+
+	// NullableTime includes time; default to nil
+	NullableTime
+
+	// Year includes year, mapped to int16 (0 for the zero year); default to 0
+	Year
+
+	// NullableYear includes year; default to nil
+	NullableYear
+
+	// Bit includes multi-bit bit(n), mapped to int64 holding the bits (bit(64) may be negative); default to 0
+	Bit
+
+	// NullableBit includes multi-bit bit(n); default to nil
+	NullableBit
+
+	// Json includes json, mapped to json.RawMessage holding canonical JSON text (also supports JSON text in char/varchar/text);
+	// default to empty
+	Json
+
+	// NullableJson includes json; default to nil
+	NullableJson
+
+	// Geometry includes geometry, point, linestring, polygon, multi* & geometrycollection, mapped to spatial.Geometry,
+	// synced to MSSQL geometry; default to empty
+	Geometry
+
+	// NullableGeometry includes spatial types; default to nil
+	NullableGeometry
+
+	// Geography includes spatial types, mapped to spatial.Geography, synced to MSSQL geography
+	// (for longitude/latitude coordinates, SRID 0 becomes 4326); default to empty
+	Geography
+
+	// NullableGeography includes spatial types; default to nil
+	NullableGeography
+
+	// UInt8 includes unsigned tinyint, mapped to uint8, synced to MSSQL tinyint; default to 0
+	UInt8
+
+	// NullableUInt8 includes unsigned tinyint; default to nil
+	NullableUInt8
+
+	// UInt16 includes unsigned smallint, mapped to uint16, synced to MSSQL int; default to 0
+	UInt16
+
+	// NullableUInt16 includes unsigned smallint; default to nil
+	NullableUInt16
+
+	// UInt32 includes unsigned mediumint & int, mapped to uint32, synced to MSSQL bigint; default to 0
+	UInt32
+
+	// NullableUInt32 includes unsigned mediumint & int; default to nil
+	NullableUInt32
+
+	// UInt64 includes unsigned bigint, mapped to uint64, synced to MSSQL decimal(20,0); default to 0
+	UInt64
+
+	// NullableUInt64 includes unsigned bigint; default to nil
+	NullableUInt64
 )
 
 // Entry is a record stored in database
@@ -101,8 +170,14 @@ type Interface interface {
 	GetAll(bucket string) ([]*Entry, error)
 	// GetAllKey returns all data for a key
 	GetAllKey(bucket string, key string) ([][]byte, error)
+	// GetRange returns the elements of list from index `start` to `end` (inclusive), negative indexes are offsets from the end of the list
+	GetRange(bucket string, key string, start int, end int) ([][]byte, error)
+	// Get returns the value put at key in a bucket, nil if the key does not exist
+	Get(bucket string, key string) ([]byte, error)
 	// Put or override an entry in a bucket
 	Put(bucket string, key string, value []byte, ttl uint32) error
+	// Delete an entry put in a bucket, deleting a missing key is a no-op
+	Delete(bucket string, key string) error
 	// Push inserts the value at the tail of the list stored in the bucket at given key
 	Push(bucket string, key string, value []byte) error
 	// Rem remove `count` elements from List from left
@@ -159,6 +234,122 @@ func Convert(mType MySQLType) interface{} {
 		t = []string{}
 	case NullableSet:
 		t = new([]string)
+	case Time:
+		t = time.Duration(0)
+	case NullableTime:
+		t = new(time.Duration)
+	case Year:
+		t = int16(0)
+	case NullableYear:
+		t = new(int16)
+	case Bit:
+		t = int64(0)
+	case NullableBit:
+		t = new(int64)
+	case Json:
+		t = json.RawMessage{}
+	case NullableJson:
+		t = new(json.RawMessage)
+	case Geometry:
+		t = spatial.Geometry{}
+	case NullableGeometry:
+		t = new(spatial.Geometry)
+	case Geography:
+		t = spatial.Geography{}
+	case NullableGeography:
+		t = new(spatial.Geography)
+	case UInt8:
+		t = uint8(0)
+	case NullableUInt8:
+		t = new(uint8)
+	case UInt16:
+		t = uint16(0)
+	case NullableUInt16:
+		t = new(uint16)
+	case UInt32:
+		t = uint32(0)
+	case NullableUInt32:
+		t = new(uint32)
+	case UInt64:
+		t = uint64(0)
+	case NullableUInt64:
+		t = new(uint64)
 	}
 	return t
 }
+
+// ParseColumnType maps a MySQL column definition, as found in information_schema.COLUMNS (`DATA_TYPE` & `COLUMN_TYPE`),
+// to the MySQLType able to hold its values. Decimal columns are mapped to Decimal if `useDecimal` is true, Double otherwise
+// (must match the parser's UseDecimal option)
+func ParseColumnType(dataType string, columnType string, nullable bool, useDecimal bool) (mType MySQLType, err error) {
+	dataType = strings.ToLower(dataType)
+	columnType = strings.ToLower(columnType)
+	switch dataType {
+	case "tinyint":
+		if strings.HasPrefix(columnType, "tinyint(1)") {
+			mType = Bool
+		} else if strings.Contains(columnType, "unsigned") {
+			mType = UInt8
+		} else {
+			mType = Int
+		}
+	case "bit":
+		if columnType == "bit(1)" {
+			mType = Bool
+		} else {
+			mType = Bit
+		}
+	case "smallint":
+		if strings.Contains(columnType, "unsigned") {
+			mType = UInt16
+		} else {
+			mType = Int
+		}
+	case "mediumint", "int", "integer":
+		if strings.Contains(columnType, "unsigned") {
+			mType = UInt32
+		} else {
+			mType = Int
+		}
+	case "year":
+		mType = Year
+	case "time":
+		mType = Time
+	case "bigint":
+		if strings.Contains(columnType, "unsigned") {
+			mType = UInt64
+		} else {
+			mType = Int
+		}
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum":
+		mType = String
+	case "json":
+		mType = Json
+	case "date", "datetime", "timestamp":
+		mType = DateTime
+	case "float":
+		mType = Float
+	case "double", "real":
+		mType = Double
+	case "decimal", "numeric":
+		if useDecimal {
+			mType = Decimal
+		} else {
+			mType = Double
+		}
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		mType = Blob
+	case "set":
+		mType = Set
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon",
+		"geometrycollection", "geomcollection":
+		mType = Geometry
+	default:
+		return 0, fmt.Errorf("unsupported MySQL type %v", columnType)
+	}
+	// every nullable type directly follows its non-nullable counterpart
+	if nullable {
+		mType++
+	}
+	return
+}
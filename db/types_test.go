@@ -0,0 +1,86 @@
+package db
+
+import "testing"
+
+func TestParseColumnType(t *testing.T) {
+	for _, c := range []struct {
+		dataType   string
+		columnType string
+		useDecimal bool
+		mType      MySQLType
+	}{
+		{"tinyint", "tinyint(1)", false, Bool},
+		{"tinyint", "tinyint(4)", false, Int},
+		{"tinyint", "tinyint(3) unsigned", false, UInt8},
+		{"tinyint", "tinyint(1) unsigned", false, Bool},
+		{"bit", "bit(1)", false, Bool},
+		{"bit", "bit(8)", false, Bit},
+		{"bit", "bit(64)", false, Bit},
+		{"smallint", "smallint(6)", false, Int},
+		{"smallint", "smallint(5) unsigned", false, UInt16},
+		{"mediumint", "mediumint(9)", false, Int},
+		{"mediumint", "mediumint(8) unsigned", false, UInt32},
+		{"int", "int(11)", false, Int},
+		{"int", "int(10) unsigned", false, UInt32},
+		{"INT", "INT(10) UNSIGNED", false, UInt32},
+		{"integer", "integer", false, Int},
+		{"integer", "integer unsigned", false, UInt32},
+		{"bigint", "bigint(20)", false, Int},
+		{"bigint", "bigint(20) unsigned", false, UInt64},
+		{"bigint", "bigint(20) unsigned zerofill", false, UInt64},
+		{"year", "year(4)", false, Year},
+		{"time", "time", false, Time},
+		{"time", "time(6)", false, Time},
+		{"char", "char(10)", false, String},
+		{"varchar", "varchar(255)", false, String},
+		{"tinytext", "tinytext", false, String},
+		{"text", "text", false, String},
+		{"mediumtext", "mediumtext", false, String},
+		{"longtext", "longtext", false, String},
+		{"enum", "enum('a','b')", false, String},
+		{"json", "json", false, Json},
+		{"date", "date", false, DateTime},
+		{"datetime", "datetime", false, DateTime},
+		{"timestamp", "timestamp", false, DateTime},
+		{"float", "float", false, Float},
+		{"double", "double", false, Double},
+		{"real", "real", false, Double},
+		{"decimal", "decimal(10,2)", false, Double},
+		{"decimal", "decimal(10,2)", true, Decimal},
+		{"numeric", "numeric(10,2)", true, Decimal},
+		{"binary", "binary(16)", false, Blob},
+		{"varbinary", "varbinary(16)", false, Blob},
+		{"tinyblob", "tinyblob", false, Blob},
+		{"blob", "blob", false, Blob},
+		{"mediumblob", "mediumblob", false, Blob},
+		{"longblob", "longblob", false, Blob},
+		{"set", "set('a','b')", false, Set},
+		{"geometry", "geometry", false, Geometry},
+		{"point", "point", false, Geometry},
+		{"linestring", "linestring", false, Geometry},
+		{"polygon", "polygon", false, Geometry},
+		{"multipoint", "multipoint", false, Geometry},
+		{"multilinestring", "multilinestring", false, Geometry},
+		{"multipolygon", "multipolygon", false, Geometry},
+		{"geometrycollection", "geometrycollection", false, Geometry},
+		{"geomcollection", "geomcollection", false, Geometry},
+	} {
+		for _, nullable := range []bool{false, true} {
+			expected := c.mType
+			// every nullable type directly follows its non-nullable counterpart
+			if nullable {
+				expected++
+			}
+			mType, err := ParseColumnType(c.dataType, c.columnType, nullable, c.useDecimal)
+			if err != nil {
+				t.Errorf("%v (nullable: %v) - Unexpected error: %v", c.columnType, nullable, err)
+			} else if mType != expected {
+				t.Errorf("%v (nullable: %v) - Expected: %v, Actual: %v", c.columnType, nullable, expected, mType)
+			}
+		}
+	}
+
+	if _, err := ParseColumnType("unknown", "unknown", false, false); err == nil {
+		t.Error("Expected error on unsupported type")
+	}
+}
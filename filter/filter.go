@@ -0,0 +1,340 @@
+// Package filter provides the row filters of datamodels (see param.StructRequest.Filter),
+// SQL-like predicates on the columns of a row parsed from binlog, such as "active = 1 AND store_id IN (1, 2)"
+package filter
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Filter is a predicate compiled against the columns of a datamodel
+type Filter struct {
+	expr string
+	root node
+}
+
+// New compiles predicate `expr` against the columns (struct tag `gorm:"column:xxx"`) of datamodel `model`.
+//
+// Syntax: comparisons of a column with a literal (=, !=, <>, <, <=, >, >=), [NOT] IN (...), [NOT] LIKE '...',
+// IS [NOT] NULL, combined with AND, OR, NOT & parentheses. Literals are numbers, 'strings' or TRUE/FALSE,
+// a DateTime column is compared with 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss'. Keywords & column names are case-insensitive,
+// strings are compared case-sensitively
+func New(expr string, model interface{}) (*Filter, error) {
+	columns, err := modelColumns(model)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %v", expr, err)
+	}
+	p := &parser{tokens: tokens, columns: columns}
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %v", expr, err)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Match returns true if `rec`, a row parsed into the datamodel given to `New`, satisfies the filter.
+// As in SQL WHERE clauses, a predicate evaluated to NULL (e.g. a comparison with a NULL column) does not match
+func (f *Filter) Match(rec interface{}) bool {
+	return f.root.eval(reflect.Indirect(reflect.ValueOf(rec))) == isTrue
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// truth is a value of SQL three-valued logic
+type truth int8
+
+const (
+	isFalse truth = iota
+	isTrue
+	isUnknown
+)
+
+func truthOf(b bool) truth {
+	if b {
+		return isTrue
+	}
+	return isFalse
+}
+
+type node interface {
+	eval(row reflect.Value) truth
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(row reflect.Value) truth {
+	l, r := n.left.eval(row), n.right.eval(row)
+	if l == isFalse || r == isFalse {
+		return isFalse
+	}
+	if l == isTrue && r == isTrue {
+		return isTrue
+	}
+	return isUnknown
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(row reflect.Value) truth {
+	l, r := n.left.eval(row), n.right.eval(row)
+	if l == isTrue || r == isTrue {
+		return isTrue
+	}
+	if l == isFalse && r == isFalse {
+		return isFalse
+	}
+	return isUnknown
+}
+
+type notNode struct{ n node }
+
+func (n notNode) eval(row reflect.Value) truth {
+	switch n.n.eval(row) {
+	case isTrue:
+		return isFalse
+	case isFalse:
+		return isTrue
+	}
+	return isUnknown
+}
+
+// compareNode compares a column with a literal, `op` is one of = != < <= > >=
+type compareNode struct {
+	col   *column
+	op    string
+	value interface{}
+}
+
+func (n compareNode) eval(row reflect.Value) truth {
+	v := n.col.get(row)
+	if v == nil {
+		return isUnknown
+	}
+	c := compare(v, n.value)
+	switch n.op {
+	case "=":
+		return truthOf(c == 0)
+	case "!=":
+		return truthOf(c != 0)
+	case "<":
+		return truthOf(c < 0)
+	case "<=":
+		return truthOf(c <= 0)
+	case ">":
+		return truthOf(c > 0)
+	default:
+		return truthOf(c >= 0)
+	}
+}
+
+type inNode struct {
+	col    *column
+	values []interface{}
+}
+
+func (n inNode) eval(row reflect.Value) truth {
+	v := n.col.get(row)
+	if v == nil {
+		return isUnknown
+	}
+	for _, value := range n.values {
+		if compare(v, value) == 0 {
+			return isTrue
+		}
+	}
+	return isFalse
+}
+
+type likeNode struct {
+	col     *column
+	pattern *regexp.Regexp
+}
+
+func (n likeNode) eval(row reflect.Value) truth {
+	v := n.col.get(row)
+	if v == nil {
+		return isUnknown
+	}
+	return truthOf(n.pattern.MatchString(v.(string)))
+}
+
+type isNullNode struct{ col *column }
+
+func (n isNullNode) eval(row reflect.Value) truth {
+	return truthOf(n.col.get(row) == nil)
+}
+
+// kind of the values of a column, literals are converted to it when compiled
+type kind uint8
+
+const (
+	// numbers, decimals & bools (1 or 0), compared as decimal.Decimal
+	numberKind kind = iota + 1
+	// strings & blobs, compared as string
+	stringKind
+	// DateTime, compared as time.Time
+	timeKind
+)
+
+func (k kind) String() string {
+	switch k {
+	case numberKind:
+		return "number"
+	case stringKind:
+		return "string"
+	}
+	return "datetime"
+}
+
+type column struct {
+	name  string
+	field string
+	kind  kind
+}
+
+var (
+	decimalType = reflect.TypeOf(decimal.Decimal{})
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte{})
+)
+
+// modelColumns returns the columns of `model` read from source table, keyed by lower case name
+func modelColumns(model interface{}) (map[string]*column, error) {
+	t := reflect.Indirect(reflect.ValueOf(model)).Type()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("datamodel must be a struct, got %v", t)
+	}
+	columns := make(map[string]*column, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := columnName(f.Tag)
+		// injected fields are not set when rows are parsed
+		if name == "" || f.Tag.Get("source") == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// kind is left 0 for other types (e.g. sets), such columns can only be compared with NULL
+		c := &column{name: name, field: f.Name}
+		switch ft {
+		case decimalType:
+			c.kind = numberKind
+		case timeType:
+			c.kind = timeKind
+		case bytesType:
+			c.kind = stringKind
+		default:
+			switch ft.Kind() {
+			case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+				c.kind = numberKind
+			case reflect.String:
+				c.kind = stringKind
+			}
+		}
+		columns[strings.ToLower(name)] = c
+	}
+	return columns, nil
+}
+
+// columnName returns xxx of struct tag `gorm:"column:xxx;..."`
+func columnName(tag reflect.StructTag) string {
+	for _, setting := range strings.Split(tag.Get("gorm"), ";") {
+		if strings.HasPrefix(setting, "column:") {
+			return strings.TrimPrefix(setting, "column:")
+		}
+	}
+	return ""
+}
+
+// get returns the value of the column in `row` converted to its kind, nil if it is NULL or not in `row`
+// (`row` may be of a datamodel replaced after the filter was compiled)
+func (c *column) get(row reflect.Value) interface{} {
+	f := row.FieldByName(c.field)
+	if !f.IsValid() {
+		return nil
+	}
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return nil
+		}
+		f = f.Elem()
+	}
+	v := convert(f)
+	switch v.(type) {
+	case decimal.Decimal:
+		if c.kind == numberKind {
+			return v
+		}
+	case string:
+		if c.kind == stringKind {
+			return v
+		}
+	case time.Time:
+		if c.kind == timeKind {
+			return v
+		}
+	}
+	return nil
+}
+
+// convert a field value to decimal.Decimal, string or time.Time, nil if it has no kind
+func convert(f reflect.Value) interface{} {
+	switch f.Type() {
+	case decimalType, timeType:
+		return f.Interface()
+	case bytesType:
+		return string(f.Bytes())
+	}
+	switch f.Kind() {
+	case reflect.Bool:
+		if f.Bool() {
+			return decimal.NewFromInt(1)
+		}
+		return decimal.Zero
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return decimal.NewFromInt(f.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return decimal.NewFromBigInt(new(big.Int).SetUint64(f.Uint()), 0)
+	case reflect.Float32:
+		return decimal.NewFromFloat32(float32(f.Float()))
+	case reflect.Float64:
+		return decimal.NewFromFloat(f.Float())
+	case reflect.String:
+		return f.String()
+	}
+	return nil
+}
+
+// compare values of the same kind, returns -1, 0 or +1
+func compare(a interface{}, b interface{}) int {
+	switch a := a.(type) {
+	case decimal.Decimal:
+		return a.Cmp(b.(decimal.Decimal))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		b := b.(time.Time)
+		if a.Before(b) {
+			return -1
+		}
+		if a.After(b) {
+			return 1
+		}
+	}
+	return 0
+}
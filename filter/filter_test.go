@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type staff struct {
+	StaffID    int              `gorm:"column:staff_id;primaryKey"`
+	StoreID    *uint            `gorm:"column:store_id"`
+	Active     bool             `gorm:"column:active"`
+	Email      *string          `gorm:"column:email"`
+	Salary     *decimal.Decimal `gorm:"column:salary"`
+	Rating     float32          `gorm:"column:rating"`
+	LastUpdate time.Time        `gorm:"column:last_update"`
+	Tags       []string         `gorm:"column:tags"`
+	TenantID   int              `gorm:"column:tenant_id;primaryKey" source:"-"`
+}
+
+func TestMatch(t *testing.T) {
+	store, email, salary := uint(2), "Mike.Hillyer@sakilastaff.com", decimal.RequireFromString("1000.50")
+	row := &staff{
+		StaffID:    1,
+		StoreID:    &store,
+		Active:     true,
+		Email:      &email,
+		Salary:     &salary,
+		Rating:     4.2,
+		LastUpdate: time.Date(2006, 2, 15, 3, 57, 16, 0, time.UTC),
+	}
+	filters := map[string]bool{
+		"active = 1":                             true,
+		"active = FALSE":                         false,
+		"ACTIVE = true and store_id IN (1, 2)":   true,
+		"store_id NOT IN (1, 2)":                 false,
+		"staff_id <> 1 OR NOT (store_id < 2)":    true,
+		"staff_id != 1 OR store_id < 2":          false,
+		"`staff_id` >= 1 AND staff_id <= 1":      true,
+		"staff_id > -1":                          true,
+		"email LIKE '%@sakilastaff.com'":         true,
+		"email LIKE 'mike%'":                     false,
+		"email NOT LIKE 'M_ke.%'":                false,
+		"email = 'Mike.Hillyer@sakilastaff.com'": true,
+		"email IS NOT NULL":                      true,
+		"tags IS NULL":                           true,
+		"salary > 1000.5":                        false,
+		"salary = 1000.5":                        true,
+		"rating > 4.2":                           false,
+		"rating = 4.2":                           true,
+		"last_update > '2006-02-15'":             true,
+		"last_update < '2006-02-15 03:57:16'":    false,
+	}
+	for expr, expected := range filters {
+		f, err := New(expr, row)
+		if err != nil {
+			t.Errorf("%v - New failed: %v", expr, err)
+			continue
+		}
+		if actual := f.Match(row); actual != expected {
+			t.Errorf("%v - Expected: %v, Actual: %v", expr, expected, actual)
+		}
+	}
+}
+
+// comparisons with NULL are unknown, neither them nor their negation match
+func TestMatchNull(t *testing.T) {
+	row := staff{StaffID: 1}
+	filters := map[string]bool{
+		"store_id = 1":                    false,
+		"NOT store_id = 1":                false,
+		"store_id NOT IN (1)":             false,
+		"email NOT LIKE '%'":              false,
+		"store_id = 1 OR staff_id = 1":    true,
+		"NOT (store_id = 1 AND active=1)": true,
+		"store_id IS NULL":                true,
+	}
+	for expr, expected := range filters {
+		f, err := New(expr, row)
+		if err != nil {
+			t.Errorf("%v - New failed: %v", expr, err)
+			continue
+		}
+		if actual := f.Match(row); actual != expected {
+			t.Errorf("%v - Expected: %v, Actual: %v", expr, expected, actual)
+		}
+	}
+}
+
+func TestNewError(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"unknown = 1",
+		"tenant_id = 1",
+		"staff_id = '1'",
+		"email = 1",
+		"email LIKE 1",
+		"staff_id LIKE '1%'",
+		"tags = 'a'",
+		"last_update > 'yesterday'",
+		"staff_id IN ()",
+		"staff_id = 1 AND",
+		"(staff_id = 1",
+		"staff_id = 1)",
+		"email = 'unterminated",
+		"staff_id = 1 ; drop table staff",
+		"staff_id NOT = 1",
+	} {
+		if _, err := New(expr, staff{}); err == nil {
+			t.Errorf("%q - Expected error", expr)
+		}
+	}
+}
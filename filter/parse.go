@@ -0,0 +1,321 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+type tokenType uint8
+
+const (
+	endToken tokenType = iota
+	identToken
+	numberToken
+	stringToken
+	// operators & punctuation: = != <> < <= > >= ( ) ,
+	symbolToken
+)
+
+type token struct {
+	typ  tokenType
+	text string
+	// offset in expression, for error messages
+	pos int
+}
+
+func (t token) String() string {
+	if t.typ == endToken {
+		return "end of filter"
+	}
+	return fmt.Sprintf("%q at %d", t.text, t.pos)
+}
+
+// lex splits `expr` into tokens, the last one is always endToken
+func lex(expr string) (tokens []token, err error) {
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '\'':
+			var b strings.Builder
+			for i++; ; i++ {
+				if i == len(runes) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				if runes[i] == '\'' {
+					// '' is an escaped quote
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+				b.WriteRune(runes[i])
+			}
+			i++
+			tokens = append(tokens, token{typ: stringToken, text: b.String(), pos: start})
+			continue
+		case r == '`':
+			end := strings.IndexRune(string(runes[i+1:]), '`')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier at %d", start)
+			}
+			name := string(runes[i+1:])[:end]
+			i += len([]rune(name)) + 2
+			tokens = append(tokens, token{typ: identToken, text: name, pos: start})
+			continue
+		case unicode.IsDigit(r) || ((r == '-' || r == '.') && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i++; i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.'); i++ {
+			}
+			tokens = append(tokens, token{typ: numberToken, text: string(runes[start:i]), pos: start})
+			continue
+		case unicode.IsLetter(r) || r == '_':
+			for i++; i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_'); i++ {
+			}
+			tokens = append(tokens, token{typ: identToken, text: string(runes[start:i]), pos: start})
+			continue
+		}
+		// 2 characters operators first
+		if i+1 < len(runes) {
+			switch op := string(runes[i : i+2]); op {
+			case "!=", "<>", "<=", ">=":
+				tokens = append(tokens, token{typ: symbolToken, text: op, pos: start})
+				i += 2
+				continue
+			}
+		}
+		switch r {
+		case '=', '<', '>', '(', ')', ',':
+			tokens = append(tokens, token{typ: symbolToken, text: string(r), pos: start})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", r, start)
+		}
+	}
+	return append(tokens, token{typ: endToken, pos: len(runes)}), nil
+}
+
+// parser is a recursive descent parser of filters:
+//
+//	or        = and { "OR" and }
+//	and       = not { "AND" not }
+//	not       = "NOT" not | "(" or ")" | predicate
+//	predicate = column ( op literal | "IS" ["NOT"] "NULL" | ["NOT"] "IN" "(" literal { "," literal } ")" | ["NOT"] "LIKE" string )
+type parser struct {
+	tokens  []token
+	pos     int
+	columns map[string]*column
+}
+
+func (p *parser) parse() (node, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != endToken {
+		return nil, fmt.Errorf("unexpected %v", t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != endToken {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes the next token if it is keyword `k`
+func (p *parser) keyword(k string) bool {
+	if t := p.peek(); t.typ == identToken && strings.EqualFold(t.text, k) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// symbol consumes the next token if it is symbol `s`
+func (p *parser) symbol(s string) bool {
+	if t := p.peek(); t.typ == symbolToken && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.symbol(s) {
+		return fmt.Errorf("expected %q, got %v", s, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.keyword("OR") {
+		var right node
+		if right, err = p.parseAnd(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	for err == nil && p.keyword("AND") {
+		var right node
+		if right, err = p.parseNot(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.keyword("NOT") {
+		n, err := p.parseNot()
+		return notNode{n}, err
+	}
+	if p.symbol("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	}
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (node, error) {
+	t := p.next()
+	if t.typ != identToken {
+		return nil, fmt.Errorf("expected a column, got %v", t)
+	}
+	col := p.columns[strings.ToLower(t.text)]
+	if col == nil {
+		return nil, fmt.Errorf("unknown column %v", t.text)
+	}
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		if !p.keyword("NULL") {
+			return nil, fmt.Errorf("expected NULL, got %v", p.peek())
+		}
+		return negate(isNullNode{col}, not), nil
+	}
+	if col.kind == 0 {
+		return nil, fmt.Errorf("column %v can only be compared with NULL", col.name)
+	}
+
+	not := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		n := inNode{col: col}
+		for {
+			v, err := p.literal(col)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+			if !p.symbol(",") {
+				break
+			}
+		}
+		return negate(n, not), p.expect(")")
+	case p.keyword("LIKE"):
+		if col.kind != stringKind {
+			return nil, fmt.Errorf("LIKE on %v column %v", col.kind, col.name)
+		}
+		t := p.next()
+		if t.typ != stringToken {
+			return nil, fmt.Errorf("expected a string pattern, got %v", t)
+		}
+		return negate(likeNode{col: col, pattern: likePattern(t.text)}, not), nil
+	case not:
+		return nil, fmt.Errorf("expected IN or LIKE, got %v", p.peek())
+	}
+
+	op := p.next()
+	if op.typ != symbolToken || op.text == "(" || op.text == ")" || op.text == "," {
+		return nil, fmt.Errorf("expected an operator after column %v, got %v", col.name, op)
+	}
+	v, err := p.literal(col)
+	if err != nil {
+		return nil, err
+	}
+	if op.text == "<>" {
+		op.text = "!="
+	}
+	return compareNode{col: col, op: op.text, value: v}, nil
+}
+
+func negate(n node, not bool) node {
+	if not {
+		return notNode{n}
+	}
+	return n
+}
+
+// literal parses the next token as a literal compared with column `col`, converted to the kind of `col`
+func (p *parser) literal(col *column) (interface{}, error) {
+	t := p.next()
+	switch {
+	case col.kind == numberKind && t.typ == numberToken:
+		return decimal.NewFromString(t.text)
+	case col.kind == numberKind && t.typ == identToken && strings.EqualFold(t.text, "TRUE"):
+		return decimal.NewFromInt(1), nil
+	case col.kind == numberKind && t.typ == identToken && strings.EqualFold(t.text, "FALSE"):
+		return decimal.Zero, nil
+	case col.kind == stringKind && t.typ == stringToken:
+		return t.text, nil
+	case col.kind == timeKind && t.typ == stringToken:
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02"} {
+			if v, err := time.Parse(layout, t.text); err == nil {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("expected 'YYYY-MM-DD' or 'YYYY-MM-DD hh:mm:ss' for column %v, got %v", col.name, t)
+	}
+	return nil, fmt.Errorf("expected a %v for column %v, got %v", col.kind, col.name, t)
+}
+
+// likePattern converts a LIKE pattern to a regular expression: % matches any characters, _ one character, \ escapes them
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -1,18 +1,88 @@
 package main
 
 import (
-	"mysql2mssql/db"
+	"flag"
+	"fmt"
+	"mysql2mssql/config"
 	"mysql2mssql/server"
+	"os"
 )
 
-const (
-	// local directory to store messages
-	localDir = "D:/temp/nutsdb"
-)
+const usage = `Usage: mysql2mssql <command> [flags]
+
+Commands:
+  run       start the HTTP API, and the pipeline defined in --config if any (default)
+  validate  check a config file without running it
+
+Run "mysql2mssql <command> -h" for the flags of a command
+`
 
 func main() {
-	server.NewServer(db.Options{
-		Dir:         localDir,
-		SegmentSize: 1024 * 1024, // 1mb
-	}).StartServer("")
+	var err error
+	// without command, start the HTTP API with defaults as earlier versions did
+	if len(os.Args) < 2 {
+		os.Args = append(os.Args, "run")
+	}
+	switch os.Args[1] {
+	case "run":
+		err = run(os.Args[2:])
+	case "validate":
+		err = validate(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%v", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	path := flags.String("config", "", "pipeline config file (.yaml, .json or .toml)")
+	listen := flags.String("listen", "", "address of the HTTP API, overrides config (default \":1323\")")
+	dir := flags.String("dir", "", "Log Store directory, overrides config (default \"data\")")
+	autoResume := flags.Bool("auto-resume", false, "restart the last started parser & syncer, if not defined in config")
+	flags.Parse(args)
+
+	cfg, err := loadConfig(*path)
+	if err != nil {
+		return err
+	}
+	if *listen != "" {
+		cfg.Listen = *listen
+	}
+	if *dir != "" {
+		cfg.Store.Dir = *dir
+	}
+	if *autoResume {
+		cfg.AutoResume = true
+	}
+	return server.Run(*cfg)
+}
+
+func validate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	path := flags.String("config", "", "pipeline config file (.yaml, .json or .toml)")
+	flags.Parse(args)
+
+	if *path == "" {
+		return fmt.Errorf("--config is required")
+	}
+	if _, err := config.Load(*path); err != nil {
+		return err
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+// loadConfig loads the config file at `path`, or the defaults if `path` is empty
+func loadConfig(path string) (*config.Config, error) {
+	if path == "" {
+		return config.Default(), nil
+	}
+	return config.Load(path)
 }
@@ -0,0 +1,80 @@
+// Package metrics defines the Prometheus collectors exported by Parser, Store & Syncer,
+// they're registered to the default registry & served on /metrics by package server
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "mysql2mssql"
+
+var (
+	// ParsedEvents counts the rows read from binlog, per table & action (insert/update/delete)
+	ParsedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parsed_events_total",
+		Help:      "Rows parsed from MySQL binlog",
+	}, []string{"table", "action"})
+
+	// FilteredEvents counts the rows parsed from binlog which are skipped by the filter of their datamodel, per table.
+	// An update moving a row into or out of the filter is not counted, nor are the rows skipped by snapshots
+	FilteredEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "filtered_events_total",
+		Help:      "Rows parsed from MySQL binlog which do not match the filter of their datamodel",
+	}, []string{"table"})
+
+	// ReplicationLag is the delay between a binlog event's timestamp & the time it is parsed
+	ReplicationLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "replication_lag_seconds",
+		Help:      "Seconds between the timestamp of the last parsed binlog event and the time it was parsed",
+	})
+
+	// PendingRecords is the number of records in Log Store waiting to be synced, per table;
+	// with journal enabled, all tables are reported under table "journal"
+	PendingRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "store_pending_records",
+		Help:      "Records in Log Store waiting to be synced to MSSQL",
+	}, []string{"table"})
+
+	// AppliedRecords counts the records applied to target db, per table & action.
+	// Records of a transaction which is rolled back & applied again are counted again
+	AppliedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "applied_records_total",
+		Help:      "Records applied to MSSQL",
+	}, []string{"table", "action"})
+
+	// ApplyErrors counts the records which failed to apply to target db, per table
+	ApplyErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "apply_errors_total",
+		Help:      "Records which failed to apply to MSSQL",
+	}, []string{"table"})
+
+	// DeadLetters counts the records moved to dead letters, per table
+	DeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_letters_total",
+		Help:      "Records rejected by MSSQL and moved to dead letters",
+	}, []string{"table"})
+
+	// SyncDuration observes the duration of each sync pass (see syncer.SyncAllModels)
+	SyncDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "Duration of sync passes",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14), // 10ms to ~80s
+	})
+
+	// StatementDuration observes the latency of applying one record to target db, per action
+	StatementDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "statement_duration_seconds",
+		Help:      "Latency of MSSQL statements applying one record",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms to ~4s
+	}, []string{"action"})
+)
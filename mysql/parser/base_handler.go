@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"mysql2mssql/metrics"
+	"time"
+
 	"github.com/siddontang/go-log/log"
 	cn "github.com/siddontang/go-mysql/canal"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
 )
 
 type baseEventHandler struct {
@@ -11,16 +16,19 @@ type baseEventHandler struct {
 	EventHandlerInterface
 	models ModelMap
 	canal  *cn.Canal
+	// drifts detected in `OnTableChanged`, dispatched in `OnDDL`
+	schemaChanges []*SchemaChange
 }
 
 // Implement OnRow https://pkg.go.dev/github.com/siddontang/go-mysql/canal#EventHandler.OnRow
 func (w *baseEventHandler) OnRow(e *cn.RowsEvent) error {
 
-	if w.models[e.Table.Name] == "" || w.models[e.Table.Name] == nil {
-		log.Errorf("baseEventHandler OnRow: model is nil, make sure %v is defined in Datamodels", e.Table.Name)
+	key := w.modelKey(e.Table.Schema, e.Table.Name)
+	if key == "" {
+		log.Errorf("baseEventHandler OnRow: model is nil, make sure %v.%v or %v is defined in Datamodels", e.Table.Schema, e.Table.Name, e.Table.Name)
 		return nil
 	}
-	model := w.models[e.Table.Name]
+	model := w.models[key]
 
 	// base value for canal.DeleteAction or canal.InsertAction
 	var n = 0
@@ -31,19 +39,31 @@ func (w *baseEventHandler) OnRow(e *cn.RowsEvent) error {
 		k = 2
 	}
 
+	if e.Header != nil && e.Header.Timestamp > 0 {
+		metrics.ReplicationLag.Set(float64(time.Now().Unix() - int64(e.Header.Timestamp)))
+	}
 	for i := n; i < len(e.Rows); i += k {
-		new := getBinLogData(e, i, model)
+		metrics.ParsedEvents.WithLabelValues(key, e.Action).Inc()
+		new := getBinLogDataLenient(e, i, model)
 		if new != nil {
 			switch e.Action {
 			case cn.UpdateAction:
-				old := getBinLogData(e, i-1, model)
+				old := getBinLogDataLenient(e, i-1, model)
 				if old != nil {
-					w.OnUpdate(e.Table.Schema, e.Table.Name, old, new)
+					w.onUpdate(key, e.Table.Schema, e.Table.Name, old, new)
 				}
 			case cn.InsertAction:
-				w.OnInsert(e.Table.Schema, e.Table.Name, new)
+				if w.match(key, new) {
+					w.OnInsert(e.Table.Schema, e.Table.Name, new)
+				} else {
+					metrics.FilteredEvents.WithLabelValues(key).Inc()
+				}
 			case cn.DeleteAction:
-				w.OnDelete(e.Table.Schema, e.Table.Name, new)
+				if w.match(key, new) {
+					w.OnDelete(e.Table.Schema, e.Table.Name, new)
+				} else {
+					metrics.FilteredEvents.WithLabelValues(key).Inc()
+				}
 			default:
 				log.Errorf("baseEventHandler OnRow: Unknown action")
 			}
@@ -51,3 +71,89 @@ func (w *baseEventHandler) OnRow(e *cn.RowsEvent) error {
 	}
 	return nil
 }
+
+// modelKey returns the key of the model of source table `schema`.`table`, see `ModelResolverInterface`
+func (w *baseEventHandler) modelKey(schema string, table string) string {
+	if resolver, ok := w.EventHandlerInterface.(ModelResolverInterface); ok {
+		return resolver.ModelKey(schema, table)
+	}
+	return ModelKey(w.models, schema, table)
+}
+
+// match returns true if `rec` of model `key` is synced, see `RowFilterInterface`
+func (w *baseEventHandler) match(key string, rec interface{}) bool {
+	filter, ok := w.EventHandlerInterface.(RowFilterInterface)
+	return !ok || filter.Match(key, rec)
+}
+
+// onUpdate passes an update to `OnUpdate` if both rows are synced,
+// to `OnInsert` or `OnDelete` if it moves the row into or out of the filter
+func (w *baseEventHandler) onUpdate(key string, schema string, table string, old interface{}, new interface{}) {
+	wasSynced, isSynced := w.match(key, old), w.match(key, new)
+	switch {
+	case wasSynced && isSynced:
+		w.OnUpdate(schema, table, old, new)
+	case isSynced:
+		w.OnInsert(schema, table, new)
+	case wasSynced:
+		w.OnDelete(schema, table, old)
+	default:
+		metrics.FilteredEvents.WithLabelValues(key).Inc()
+	}
+}
+
+// Implement OnXID https://pkg.go.dev/github.com/siddontang/go-mysql/canal#EventHandler.OnXID
+func (w *baseEventHandler) OnXID(nextPos mysql.Position) error {
+	if handler, ok := w.EventHandlerInterface.(TransactionHandlerInterface); ok {
+		return handler.OnCommit()
+	}
+	return nil
+}
+
+// Implement OnPosSynced https://pkg.go.dev/github.com/siddontang/go-mysql/canal#EventHandler.OnPosSynced
+func (w *baseEventHandler) OnPosSynced(pos mysql.Position, set mysql.GTIDSet, force bool) error {
+	handler, ok := w.EventHandlerInterface.(PositionHandlerInterface)
+	if !ok {
+		return nil
+	}
+	p := Position{Name: pos.Name, Pos: pos.Pos}
+	if set != nil {
+		p.GTIDSet = set.String()
+	}
+	if err := handler.OnPosSynced(p); err != nil {
+		log.Errorf("baseEventHandler OnPosSynced: %v", err)
+	}
+	return nil
+}
+
+// Implement OnTableChanged https://pkg.go.dev/github.com/siddontang/go-mysql/canal#EventHandler.OnTableChanged
+func (w *baseEventHandler) OnTableChanged(schema string, table string) error {
+	change, err := w.detectSchemaChange(schema, table)
+	if err != nil {
+		log.Errorf("baseEventHandler OnTableChanged: %v", err)
+		return nil
+	}
+	if change != nil {
+		w.schemaChanges = append(w.schemaChanges, change)
+	}
+	return nil
+}
+
+// Implement OnDDL https://pkg.go.dev/github.com/siddontang/go-mysql/canal#EventHandler.OnDDL
+func (w *baseEventHandler) OnDDL(nextPos mysql.Position, queryEvent *replication.QueryEvent) error {
+	changes := w.schemaChanges
+	w.schemaChanges = nil
+	handler, ok := w.EventHandlerInterface.(SchemaHandlerInterface)
+	for _, change := range changes {
+		change.Query = string(queryEvent.Query)
+		if !ok {
+			log.Warnf("baseEventHandler OnDDL: datamodel of %v is stale after %v (added: %v, missing: %v)",
+				change.Table, change.Query, change.AddedColumns, change.MissingColumns)
+			continue
+		}
+		if err := handler.OnSchemaChanged(*change); err != nil {
+			log.Errorf("baseEventHandler OnDDL: %v", err)
+		}
+	}
+	return nil
+}
@@ -12,3 +12,26 @@ type EventHandlerInterface interface {
 	// Callback when a record is removed from table, refer to `OnInsert` for example
 	OnDelete(schemaName string, tableName string, rec interface{})
 }
+
+// ModelResolverInterface can be optionally implemented by the `EventHandlerInterface` passed to NewEventWrapper
+// to decide which model a source table is parsed into, instead of `ModelKey`
+type ModelResolverInterface interface {
+	// ModelKey returns the key of the model of source table `schema`.`table` in ModelMap, empty string if the table has none
+	ModelKey(schema string, table string) string
+}
+
+// RowFilterInterface can be optionally implemented by the `EventHandlerInterface` passed to NewEventWrapper
+// to skip the rows which are not synced. An update moving a row into the filter is passed to `OnInsert`,
+// an update moving it out of the filter to `OnDelete` (with the old row)
+type RowFilterInterface interface {
+	// Match returns true if `rec`, parsed into the model of key `model` in ModelMap, is synced
+	Match(model string, rec interface{}) bool
+}
+
+// TransactionHandlerInterface can be optionally implemented by the `EventHandlerInterface` passed to NewEventWrapper
+// to receive source transaction boundaries
+type TransactionHandlerInterface interface {
+	// Callback when a source transaction is committed (XID event),
+	// all events received since last commit belong to this transaction
+	OnCommit() error
+}
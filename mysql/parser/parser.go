@@ -1,9 +1,14 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
+	"mysql2mssql/spatial"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -13,8 +18,22 @@ import (
 	"github.com/siddontang/go/hack"
 )
 
-// getBinLogData reads `RowsEvent` and parses into `element` (struct)
+// type of JSON fields, compared by type as its name depends on Go version
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// getBinLogData reads `RowsEvent` and parses into `element` (struct),
+// panics if a column defined in `element` does not exist in the table
 func getBinLogData(e *canal.RowsEvent, rowNum int, placeHolder interface{}) interface{} {
+	return parseBinLogData(e, rowNum, placeHolder, false)
+}
+
+// getBinLogDataLenient is the same as getBinLogData, except that fields of columns missing in the table
+// (the datamodel is stale after a DDL event) are left at zero value
+func getBinLogDataLenient(e *canal.RowsEvent, rowNum int, placeHolder interface{}) interface{} {
+	return parseBinLogData(e, rowNum, placeHolder, true)
+}
+
+func parseBinLogData(e *canal.RowsEvent, rowNum int, placeHolder interface{}, lenient bool) interface{} {
 	element := placeHolder
 	reflectedValue := reflect.Indirect(reflect.ValueOf(element))
 	structType := reflectedValue.Type() // the input element should be Struct type (as in later we parse the tags)
@@ -23,7 +42,11 @@ func getBinLogData(e *canal.RowsEvent, rowNum int, placeHolder interface{}) inte
 		field := reflectedValue.Field(k)
 		fieldType := field.Type()
 		colName, json := parseTagSetting(structType.Field(k).Tag)
-		if colName == "" {
+		if colName == "" || isInjected(structType.Field(k).Tag) {
+			continue
+		}
+		if lenient && e.Table.FindColumn(colName) < 0 {
+			field.Set(reflect.Zero(fieldType))
 			continue
 		}
 		columnID := getColumnIDByRealName(e, colName)
@@ -65,10 +88,25 @@ func processNonNil(field reflect.Value, event *canal.RowsEvent, rowNum int, colu
 		if intVal != nil {
 			field.SetInt(*intVal)
 		}
-	case "uint":
+	case "uint", "uint8", "uint16", "uint32", "uint64": // UNSIGNED
 		uIntVal := getUint(event, rowNum, columnID)
 		if uIntVal != nil {
-			field.SetUint(*uIntVal)
+			setUint(field, *uIntVal)
+		}
+	case "int16": // YEAR
+		yearVal := getYear(event, rowNum, columnID)
+		if yearVal != nil {
+			field.SetInt(int64(*yearVal))
+		}
+	case "int64": // BIT(n)
+		bitVal := getInt(event, rowNum, columnID)
+		if bitVal != nil {
+			field.SetInt(*bitVal)
+		}
+	case "Duration": // TIME
+		durationVal := getDuration(event, rowNum, columnID)
+		if durationVal != nil {
+			field.SetInt(int64(*durationVal))
 		}
 	case "string":
 		sVal := getString(event, rowNum, columnID)
@@ -106,6 +144,21 @@ func processNonNil(field reflect.Value, event *canal.RowsEvent, rowNum int, colu
 			if dc != nil {
 				field.Set(reflect.ValueOf(*dc))
 			}
+		} else if fieldType == rawMessageType { // JSON
+			jsonVal := getJSON(event, rowNum, columnID)
+			if jsonVal != nil {
+				field.SetBytes(*jsonVal)
+			}
+		} else if fieldType.String() == "spatial.Geometry" {
+			geometry := getGeometry(event, rowNum, columnID)
+			if geometry != nil {
+				field.Set(reflect.ValueOf(*geometry))
+			}
+		} else if fieldType.String() == "spatial.Geography" {
+			geometry := getGeometry(event, rowNum, columnID)
+			if geometry != nil {
+				field.Set(reflect.ValueOf(spatial.Geography(*geometry)))
+			}
 		} else {
 			processed = false
 		}
@@ -129,11 +182,21 @@ func processNillable(field reflect.Value, event *canal.RowsEvent, rowNum int, co
 			intVal := int(*int64Val)
 			field.Set(reflect.ValueOf(&intVal)) //`field.Set()` can't implicityly infer *int64 to *int
 		}
-	case "*uint":
+	case "*uint", "*uint8", "*uint16", "*uint32", "*uint64": // UNSIGNED
 		uIntVal := getUint(event, rowNum, columnID)
-		if uIntVal != nil {
-			field.Set(reflect.ValueOf(*uIntVal))
+		if uIntVal == nil {
+			field.Set(reflect.Zero(fieldType))
+		} else {
+			v := reflect.New(fieldType.Elem())
+			setUint(v.Elem(), *uIntVal)
+			field.Set(v)
 		}
+	case "*int16": // YEAR
+		field.Set(reflect.ValueOf(getYear(event, rowNum, columnID)))
+	case "*int64": // BIT(n)
+		field.Set(reflect.ValueOf(getInt(event, rowNum, columnID)))
+	case "*time.Duration": // TIME
+		field.Set(reflect.ValueOf(getDuration(event, rowNum, columnID)))
 	case "*string":
 		sVal := getString(event, rowNum, columnID)
 		field.Set(reflect.ValueOf(sVal))
@@ -155,6 +218,12 @@ func processNillable(field reflect.Value, event *canal.RowsEvent, rowNum int, co
 			field.Set(reflect.ValueOf(bt))
 		} else if fieldType.String() == "*decimal.Decimal" {
 			field.Set(reflect.ValueOf(getDecimal(event, rowNum, columnID)))
+		} else if fieldType == reflect.PtrTo(rawMessageType) { // JSON
+			field.Set(reflect.ValueOf(getJSON(event, rowNum, columnID)))
+		} else if fieldType.String() == "*spatial.Geometry" {
+			field.Set(reflect.ValueOf(getGeometry(event, rowNum, columnID)))
+		} else if fieldType.String() == "*spatial.Geography" {
+			field.Set(reflect.ValueOf((*spatial.Geography)(getGeometry(event, rowNum, columnID))))
 		} else {
 			processed = false
 		}
@@ -239,13 +308,77 @@ func getString(event *canal.RowsEvent, rowNum int, columnID int) *string {
 	return &t
 }
 
+// getJSON returns specific field's JSON value from `RowsEvent` as canonical JSON text (see `canonicalJSON`).
+// Use this method on MYSQL JSON types, also supports JSON text in CHAR/VARCHAR/TEXT/BLOB types
+func getJSON(event *canal.RowsEvent, rowNum int, columnID int) *json.RawMessage {
+
+	var b []byte
+	switch v := event.Rows[rowNum][columnID].(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	}
+	// a NULL JSON can be logged in a NOT NULL column
+	if len(b) == 0 {
+		b = []byte("null")
+	}
+	t := json.RawMessage(canonicalJSON(b))
+	return &t
+}
+
+// canonicalJSON returns JSON text `b` without insignificant whitespace, with object keys sorted & numbers kept as written,
+// so that the text decoded from binlog (binary JSON) & read by snapshots (MySQL's formatting) is the same.
+// Invalid JSON text is returned as is
+func canonicalJSON(b []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if !json.Valid(b) || dec.Decode(&v) != nil {
+		return b
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return b
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// getGeometry returns specific field's spatial value from `RowsEvent`.
+// Use this method on MYSQL GEOMETRY/POINT/LINESTRING/POLYGON... types, logged as blobs in MySQL's internal format (see `spatial.Parse`)
+func getGeometry(event *canal.RowsEvent, rowNum int, columnID int) *spatial.Geometry {
+
+	var b []byte
+	switch v := event.Rows[rowNum][columnID].(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	}
+	g, err := spatial.Parse(b)
+	if err != nil {
+		panic(fmt.Sprintf("getGeometry failed: %v", err))
+	}
+	return &g
+}
+
 // getTime returns specific field's Time from `RowsEvent`.
-// Use this method on MYSQL DATETIME/TIMESTAMP/DATE types (does not support TIME)
+// Use this method on MYSQL DATETIME/TIMESTAMP/DATE types (does not support TIME).
+// MySQL zero dates ("0000-00-00") are returned as zero value of Go's time.Time
 func getTime(event *canal.RowsEvent, rowNum int, columnID int) *time.Time {
 
 	if event.Rows[rowNum][columnID] == nil {
 		return nil
 	}
+	if s, ok := event.Rows[rowNum][columnID].(string); ok && strings.HasPrefix(s, "0000-00-00") {
+		return &time.Time{}
+	}
 
 	switch event.Table.Columns[columnID].Type {
 	case schema.TYPE_TIMESTAMP, schema.TYPE_DATETIME:
@@ -265,6 +398,68 @@ func getTime(event *canal.RowsEvent, rowNum int, columnID int) *time.Time {
 	}
 }
 
+// getDuration returns specific field's Duration from `RowsEvent`.
+// Use this method on MYSQL TIME types, formatted "[-]hh:mm:ss[.ffffff]" by the parser (from -838:59:59 to 838:59:59)
+func getDuration(event *canal.RowsEvent, rowNum int, columnID int) *time.Duration {
+
+	if event.Rows[rowNum][columnID] == nil {
+		return nil
+	}
+	s, ok := event.Rows[rowNum][columnID].(string)
+	if !ok || event.Table.Columns[columnID].Type != schema.TYPE_TIME {
+		panic(fmt.Sprintf("getDuration failed, make sure you are converting Time only"))
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		panic(fmt.Sprintf("parseDuration failed: %v", err))
+	}
+	return &d
+}
+
+// parseDuration parses MySQL TIME value `s`, formatted "[-]hh:mm:ss[.ffffff]" (hh may have 3 digits)
+func parseDuration(s string) (time.Duration, error) {
+	var sign time.Duration = 1
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid TIME value %q", s)
+	}
+	seconds, fraction := parts[2], ""
+	if i := strings.IndexByte(seconds, '.'); i >= 0 {
+		seconds, fraction = seconds[:i], seconds[i+1:]
+	}
+	h, errH := strconv.ParseUint(parts[0], 10, 16)
+	m, errM := strconv.ParseUint(parts[1], 10, 8)
+	sec, errS := strconv.ParseUint(seconds, 10, 8)
+	var ns uint64
+	var errF error
+	if fraction != "" {
+		// right-pad to nanoseconds
+		if len(fraction) > 9 {
+			fraction = fraction[:9]
+		}
+		ns, errF = strconv.ParseUint(fraction+strings.Repeat("0", 9-len(fraction)), 10, 32)
+	}
+	if errH != nil || errM != nil || errS != nil || errF != nil || m > 59 || sec > 59 {
+		return 0, fmt.Errorf("invalid TIME value %q", s)
+	}
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second + time.Duration(ns)
+	return sign * d, nil
+}
+
+// getYear returns specific field's YEAR value from `RowsEvent`, 0 for the zero year
+func getYear(event *canal.RowsEvent, rowNum int, columnID int) *int16 {
+
+	v := getInt(event, rowNum, columnID)
+	if v == nil {
+		return nil
+	}
+	year := int16(*v)
+	return &year
+}
+
 // getInt returns specific field's int64 value from `RowsEvent`
 func getInt(event *canal.RowsEvent, rowNum int, columnID int) *int64 {
 
@@ -303,7 +498,8 @@ func getInt(event *canal.RowsEvent, rowNum int, columnID int) *int64 {
 }
 
 // getUint returns specific field's uint64 value from `RowsEvent`.
-// Use this method on MYSQL UNSIGNED BIGINT types (because it would overflow with int)
+// Use this method on MYSQL UNSIGNED TINYINT/SMALLINT/MEDIUMINT/INT/BIGINT types (because they would overflow with int),
+// a negative value (the column is not known as unsigned) is read as the unsigned integer of the same width
 func getUint(event *canal.RowsEvent, rowNum int, columnID int) *uint64 {
 
 	if event.Rows[rowNum][columnID] == nil {
@@ -311,12 +507,49 @@ func getUint(event *canal.RowsEvent, rowNum int, columnID int) *uint64 {
 	}
 
 	var t uint64
-	if event.Table.Columns[columnID].Type == schema.TYPE_NUMBER {
-		t = event.Rows[rowNum][columnID].(uint64)
+	switch event.Table.Columns[columnID].Type {
+	case schema.TYPE_NUMBER, schema.TYPE_MEDIUM_INT:
+
+		switch v := event.Rows[rowNum][columnID].(type) {
+		case uint8:
+			t = uint64(v)
+		case uint16:
+			t = uint64(v)
+		case uint32:
+			t = uint64(v)
+		case uint64:
+			t = v
+		case uint:
+			t = uint64(v)
+		case int8:
+			t = uint64(uint8(v))
+		case int16:
+			t = uint64(uint16(v))
+		case int32:
+			if event.Table.Columns[columnID].Type == schema.TYPE_MEDIUM_INT {
+				// 3 bytes
+				t = uint64(uint32(v) & 0xFFFFFF)
+			} else {
+				t = uint64(uint32(v))
+			}
+		case int64:
+			t = uint64(v)
+		case int:
+			t = uint64(v)
+		}
 	}
 	return &t
 }
 
+// setUint sets unsigned integer field `field` to `v`,
+// panics if `v` overflows the type of `field` (the datamodel does not match the column type)
+func setUint(field reflect.Value, v uint64) {
+	if field.OverflowUint(v) {
+		panic(fmt.Sprintf("setUint failed: %v overflows %v, make sure the datamodel matches the column type", v, field.Type()))
+	}
+	field.SetUint(v)
+}
+
 // getFloat32 returns specific field's float32 value from `RowsEvent`.
 // Use this method on MYSQL FLOAT types
 func getFloat32(event *canal.RowsEvent, rowNum int, columnID int) *float32 {
@@ -394,6 +627,13 @@ func parseTagSetting(tags reflect.StructTag) (colName string, json string) {
 	return hackFind(tags.Get("gorm"), 58, 59)
 }
 
+// isInjected returns true if the field is not read from source table but set by the event handler,
+// example:
+//	`gorm:"column:tenant_id;primaryKey" source:"-"`
+func isInjected(tags reflect.StructTag) bool {
+	return tags.Get("source") == "-"
+}
+
 // find the string between delimiters, this is a hack to avoid memalloc, be warned!
 //	hackFind("hello:playground;rest", 58, 59) => "playground", "rest" // from ":" to ";"
 //	hackFind("hello:playground;rest", 58, 0) => "rest", "" // from ";"
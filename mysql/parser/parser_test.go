@@ -1,9 +1,14 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
+	"mysql2mssql/spatial"
+	"reflect"
 	"testing"
 	"time"
 
+	d "github.com/shopspring/decimal"
 	"github.com/siddontang/go-mysql/canal"
 	"github.com/siddontang/go-mysql/schema"
 )
@@ -161,6 +166,20 @@ func TestPanic(t *testing.T) {
 	_ = getBinLogData(&e, 0, &binlogInvalidStruct{}).(binlogInvalidStruct)
 }
 
+func Test_getBinLogDataLenient(t *testing.T) {
+	rows := [][]interface{}{{int32(1)}}
+	columns := []schema.TableColumn{{Name: "int", Type: schema.TYPE_NUMBER}}
+	table := schema.Table{Schema: "test", Name: "test", Columns: columns}
+	e := canal.RowsEvent{Table: &table, Action: canal.InsertAction, Rows: rows}
+
+	// column "id" is missing in table, field is left at zero value
+	model := &binlogInvalidStruct{Int: 10}
+	actual := getBinLogDataLenient(&e, 0, model).(binlogInvalidStruct)
+	if actual.Int != 0 {
+		t.Errorf("Expected: 0, Actual: %v", actual.Int)
+	}
+}
+
 func TestJson(t *testing.T) {
 	// model := JSONData{}
 	rows := make([][]interface{}, 1)
@@ -192,6 +211,76 @@ func TestJson(t *testing.T) {
 	}
 }
 
+func Test_getBinLogDataInjected(t *testing.T) {
+	rows := [][]interface{}{{int32(1)}}
+	columns := []schema.TableColumn{{Name: "int", Type: schema.TYPE_NUMBER}}
+	table := schema.Table{Schema: "tenant_1", Name: "test", Columns: columns}
+	e := canal.RowsEvent{Table: &table, Action: canal.InsertAction, Rows: rows}
+
+	// column "tenant_id" is not read from table, no panic
+	model := &struct {
+		Int      int    `gorm:"column:int"`
+		TenantID string `gorm:"column:tenant_id;primaryKey" source:"-"`
+	}{}
+	getBinLogData(&e, 0, model)
+	if model.Int != 1 || model.TenantID != "" {
+		t.Errorf("Expected: {1 \"\"}, Actual: %v", *model)
+	}
+	if cols := modelColumnNames(model); len(cols) != 1 {
+		t.Errorf("Expected injected column not to be compared with source table, Actual: %v", cols)
+	}
+}
+
+func TestModelKey(t *testing.T) {
+	models := ModelMap{"tenant1.staff": &binlogInvalidStruct{}, "staff": &binlogInvalidStruct{}}
+	keys := map[[2]string]string{
+		{"tenant1", "staff"}: "tenant1.staff",
+		{"tenant2", "staff"}: "staff",
+		{"tenant1", "store"}: "",
+	}
+	for table, expected := range keys {
+		if actual := ModelKey(models, table[0], table[1]); actual != expected {
+			t.Errorf("%v.%v - Expected: %q, Actual: %q", table[0], table[1], expected, actual)
+		}
+	}
+}
+
+// values read by the snapshot (text protocol) must be parsed the same way as binlog values
+func Test_textToBinlogValue(t *testing.T) {
+	columns := []schema.TableColumn{
+		{Name: "int", Type: schema.TYPE_NUMBER, RawType: "int(11)"},
+		{Name: "float", Type: schema.TYPE_FLOAT, RawType: "float"},
+		{Name: "enum", Type: schema.TYPE_ENUM, RawType: "enum('Active','Deleted')", EnumValues: []string{"Active", "Deleted"}},
+		{Name: "string", Type: schema.TYPE_STRING, RawType: "varchar(100)"},
+		{Name: "set", Type: schema.TYPE_SET, RawType: "set('x','y','z','t')", SetValues: []string{"x", "y", "z", "t"}},
+		{Name: "bit", Type: schema.TYPE_BIT, RawType: "bit(16)"},
+		{Name: "blob", Type: schema.TYPE_STRING, RawType: "blob"},
+		{Name: "dec", Type: schema.TYPE_DECIMAL, RawType: "decimal(10,2)"},
+	}
+	text := []interface{}{int64(1), float64(1.5), []byte("Deleted"), []byte("test text"), []byte("x,t"), []byte{1, 2}, []byte("blob"), []byte("12.50")}
+	expected := []interface{}{int64(1), float32(1.5), int64(2), "test text", int64(9), int64(258), []byte("blob"), d.RequireFromString("12.50")}
+
+	for i, col := range columns {
+		actual, err := textToBinlogValue(&col, text[i], true)
+		if err != nil {
+			t.Errorf("%s: %v", col.Name, err)
+			continue
+		}
+		if dec, ok := actual.(d.Decimal); ok {
+			if !dec.Equal(expected[i].(d.Decimal)) {
+				t.Errorf("%s - Expected: %v, Actual: %v", col.Name, expected[i], actual)
+			}
+		} else if !reflect.DeepEqual(actual, expected[i]) {
+			t.Errorf("%s - Expected: %#v, Actual: %#v", col.Name, expected[i], actual)
+		}
+	}
+
+	set := getSet(&canal.RowsEvent{Table: &schema.Table{Columns: columns}, Rows: [][]interface{}{{nil, nil, nil, nil, expected[4]}}}, 0, 4)
+	if !reflect.DeepEqual(*set, []string{"x", "t"}) {
+		t.Errorf("Set value did not round trip, actual: %v", *set)
+	}
+}
+
 type binlogTestStruct struct {
 	Int             int        `gorm:"column:int"`
 	Bool            bool       `gorm:"column:bool"`
@@ -254,3 +343,229 @@ func mockInsertRowEvent(inserts int) (e *canal.RowsEvent, insertRows []interface
 
 	return &canal.RowsEvent{Table: &table, Action: canal.InsertAction, Rows: rows}, insertRows
 }
+
+func Test_getBinLogDataZeroDate(t *testing.T) {
+	rows := [][]interface{}{{"0000-00-00 00:00:00", "0000-00-00"}}
+	columns := []schema.TableColumn{{Name: "datetime", Type: schema.TYPE_DATETIME}, {Name: "date", Type: schema.TYPE_DATE}}
+	table := schema.Table{Schema: "test", Name: "test", Columns: columns}
+	e := canal.RowsEvent{Table: &table, Action: canal.InsertAction, Rows: rows}
+
+	// MySQL zero dates do not panic, they're parsed as zero time
+	model := &struct {
+		DateTime time.Time  `gorm:"column:datetime"`
+		Date     *time.Time `gorm:"column:date"`
+	}{}
+	getBinLogData(&e, 0, model)
+	if !model.DateTime.IsZero() || model.Date == nil || !model.Date.IsZero() {
+		t.Errorf("Expected zero times, Actual: %v", *model)
+	}
+}
+
+// filterTestHandler records the callbacks, only rows with a positive "id" are synced
+type filterTestHandler struct {
+	calls []string
+}
+
+func (h *filterTestHandler) OnInsert(schemaName string, tableName string, rec interface{}) {
+	h.calls = append(h.calls, "insert")
+}
+func (h *filterTestHandler) OnUpdate(schemaName string, tableName string, old interface{}, new interface{}) {
+	h.calls = append(h.calls, "update")
+}
+func (h *filterTestHandler) OnDelete(schemaName string, tableName string, rec interface{}) {
+	h.calls = append(h.calls, "delete")
+}
+func (h *filterTestHandler) Match(model string, rec interface{}) bool {
+	return rec.(binlogInvalidStruct).Int > 0
+}
+
+func TestOnRowFilter(t *testing.T) {
+	h := &filterTestHandler{}
+	base := &baseEventHandler{models: ModelMap{"test": &binlogInvalidStruct{}}, EventHandlerInterface: h}
+	table := &schema.Table{Schema: "test", Name: "test", Columns: []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}}}
+
+	events := []*canal.RowsEvent{
+		{Table: table, Action: canal.InsertAction, Rows: [][]interface{}{{int32(1)}, {int32(0)}}},
+		// in => in, out => in, in => out, out => out
+		{Table: table, Action: canal.UpdateAction, Rows: [][]interface{}{
+			{int32(1)}, {int32(2)}, {int32(0)}, {int32(1)}, {int32(1)}, {int32(0)}, {int32(0)}, {int32(-1)},
+		}},
+		{Table: table, Action: canal.DeleteAction, Rows: [][]interface{}{{int32(0)}, {int32(1)}}},
+	}
+	for _, e := range events {
+		base.OnRow(e)
+	}
+	expected := []string{"insert", "update", "insert", "delete", "delete"}
+	if !reflect.DeepEqual(h.calls, expected) {
+		t.Errorf("Expected: %v, Actual: %v", expected, h.calls)
+	}
+}
+
+func Test_getBinLogDataTimeYearBit(t *testing.T) {
+	rows := [][]interface{}{{"-838:59:59.500000", 2021, int64(-1), nil, int64(0xA5)}}
+	columns := []schema.TableColumn{
+		{Name: "time", Type: schema.TYPE_TIME},
+		{Name: "year", Type: schema.TYPE_NUMBER},
+		{Name: "bit", Type: schema.TYPE_BIT},
+		{Name: "ntime", Type: schema.TYPE_TIME},
+		{Name: "nbit", Type: schema.TYPE_BIT},
+	}
+	table := schema.Table{Schema: "test", Name: "test", Columns: columns}
+	e := canal.RowsEvent{Table: &table, Action: canal.InsertAction, Rows: rows}
+
+	model := &struct {
+		Time  time.Duration  `gorm:"column:time"`
+		Year  int16          `gorm:"column:year"`
+		Bit   int64          `gorm:"column:bit"`
+		NTime *time.Duration `gorm:"column:ntime"`
+		NBit  *int64         `gorm:"column:nbit"`
+	}{}
+	getBinLogData(&e, 0, model)
+	expected := -(838*time.Hour + 59*time.Minute + 59*time.Second + 500*time.Millisecond)
+	if model.Time != expected || model.Year != 2021 || uint64(model.Bit) != 0xFFFFFFFFFFFFFFFF ||
+		model.NTime != nil || model.NBit == nil || *model.NBit != 0xA5 {
+		t.Errorf("Actual: %+v", *model)
+	}
+}
+
+func Test_parseDuration(t *testing.T) {
+	durations := map[string]time.Duration{
+		"00:00:00":          0,
+		"12:34:56":          12*time.Hour + 34*time.Minute + 56*time.Second,
+		"-00:00:01.000001":  -(time.Second + time.Microsecond),
+		"838:59:59":         838*time.Hour + 59*time.Minute + 59*time.Second,
+		"25:00:00.5":        25*time.Hour + 500*time.Millisecond,
+		"-100:00:00.123456": -(100*time.Hour + 123456*time.Microsecond),
+	}
+	for s, expected := range durations {
+		if actual, err := parseDuration(s); actual != expected || err != nil {
+			t.Errorf("%v - Expected: %v, Actual: %v %v", s, expected, actual, err)
+		}
+	}
+	for _, s := range []string{"", "12:34", "12:60:00", "aa:00:00", "12:00:00.x"} {
+		if _, err := parseDuration(s); err == nil {
+			t.Errorf("%q - Expected error", s)
+		}
+	}
+}
+
+func Test_getBinLogDataJSON(t *testing.T) {
+	rows := [][]interface{}{
+		// decoded from binary JSON
+		{[]byte(`{"b":1,"a":[1.50,"x<y"]}`), nil, "not json"},
+		// read by snapshot
+		{[]byte(`{"a": [1.50, "x<y"], "b": 1}`), []byte{}, `[ 1, 2 ]`},
+	}
+	columns := []schema.TableColumn{
+		{Name: "json", Type: schema.TYPE_JSON},
+		{Name: "njson", Type: schema.TYPE_JSON},
+		{Name: "text", Type: schema.TYPE_STRING},
+	}
+	table := schema.Table{Schema: "test", Name: "test", Columns: columns}
+	e := canal.RowsEvent{Table: &table, Action: canal.InsertAction, Rows: rows}
+
+	type model struct {
+		JSON  json.RawMessage  `gorm:"column:json"`
+		NJSON *json.RawMessage `gorm:"column:njson"`
+		Text  json.RawMessage  `gorm:"column:text"`
+	}
+	first := getBinLogData(&e, 0, &model{}).(model)
+	second := getBinLogData(&e, 1, &model{}).(model)
+	expected := `{"a":[1.50,"x<y"],"b":1}`
+	if string(first.JSON) != expected || string(second.JSON) != expected {
+		t.Errorf("Expected: %s, Actual: %s & %s", expected, first.JSON, second.JSON)
+	}
+	if first.NJSON != nil || second.NJSON == nil || string(*second.NJSON) != "null" {
+		t.Errorf("Expected nil & null, Actual: %v & %v", first.NJSON, second.NJSON)
+	}
+	// invalid JSON text is kept as is
+	if string(first.Text) != "not json" || string(second.Text) != "[1,2]" {
+		t.Errorf("Actual: %s & %s", first.Text, second.Text)
+	}
+}
+
+func Test_getBinLogDataGeometry(t *testing.T) {
+	// POINT(1 2) with SRID 4326 in MySQL's internal format
+	point := []byte{0xE6, 0x10, 0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 240, 63, 0, 0, 0, 0, 0, 0, 0, 64}
+	rows := [][]interface{}{
+		// logged as blob
+		{point, nil, point},
+		// read by snapshot
+		{string(point), point, string(point)},
+	}
+	columns := []schema.TableColumn{
+		{Name: "location", Type: schema.TYPE_POINT},
+		{Name: "nlocation", Type: schema.TYPE_POINT},
+		{Name: "shape", Type: schema.TYPE_STRING, RawType: "geometry"},
+	}
+	table := schema.Table{Schema: "test", Name: "test", Columns: columns}
+	e := canal.RowsEvent{Table: &table, Action: canal.InsertAction, Rows: rows}
+
+	type model struct {
+		Location  spatial.Geography  `gorm:"column:location"`
+		NLocation *spatial.Geography `gorm:"column:nlocation"`
+		Shape     spatial.Geometry   `gorm:"column:shape"`
+	}
+	for i := range rows {
+		m := getBinLogData(&e, i, &model{}).(model)
+		if m.Location.SRID != 4326 || !bytes.Equal(m.Location.WKB, point[4:]) {
+			t.Errorf("row %d - Expected location SRID 4326 & WKB %x, Actual: %v %x", i, point[4:], m.Location.SRID, m.Location.WKB)
+		}
+		if (i == 0) != (m.NLocation == nil) {
+			t.Errorf("row %d - Actual nlocation: %v", i, m.NLocation)
+		}
+		if m.Shape.SRID != 4326 || !bytes.Equal(m.Shape.WKB, point[4:]) {
+			t.Errorf("row %d - Expected shape SRID 4326 & WKB %x, Actual: %v %x", i, point[4:], m.Shape.SRID, m.Shape.WKB)
+		}
+	}
+}
+
+func Test_getBinLogDataUnsigned(t *testing.T) {
+	rows := [][]interface{}{
+		// decoded from binlog, converted to unsigned by canal
+		{uint8(255), uint16(65535), uint32(16777215), uint32(4294967295), uint64(18446744073709551615), uint64(18446744073709551615)},
+		// decoded from binlog, column not known as unsigned
+		{int8(-1), int16(-1), int32(-1), int32(-1), int64(-1), int64(-1)},
+		// read by snapshot
+		{uint64(255), uint64(65535), uint64(16777215), uint64(4294967295), uint64(18446744073709551615), nil},
+	}
+	columns := []schema.TableColumn{
+		{Name: "tiny", Type: schema.TYPE_NUMBER},
+		{Name: "small", Type: schema.TYPE_NUMBER},
+		{Name: "medium", Type: schema.TYPE_MEDIUM_INT},
+		{Name: "int", Type: schema.TYPE_NUMBER},
+		{Name: "big", Type: schema.TYPE_NUMBER},
+		{Name: "nbig", Type: schema.TYPE_NUMBER},
+	}
+	table := schema.Table{Schema: "test", Name: "test", Columns: columns}
+	e := canal.RowsEvent{Table: &table, Action: canal.InsertAction, Rows: rows}
+
+	type model struct {
+		Tiny   uint8   `gorm:"column:tiny"`
+		Small  *uint16 `gorm:"column:small"`
+		Medium uint32  `gorm:"column:medium"`
+		Int    *uint32 `gorm:"column:int"`
+		Big    uint64  `gorm:"column:big"`
+		NBig   *uint   `gorm:"column:nbig"`
+	}
+	for i := range rows {
+		m := getBinLogData(&e, i, &model{}).(model)
+		if m.Tiny != 255 || *m.Small != 65535 || m.Medium != 16777215 || *m.Int != 4294967295 || m.Big != 18446744073709551615 {
+			t.Errorf("row %d - Expected max values, Actual: %v %v %v %v %v", i, m.Tiny, *m.Small, m.Medium, *m.Int, m.Big)
+		}
+		if (i == 2) != (m.NBig == nil) || (m.NBig != nil && *m.NBig != 18446744073709551615) {
+			t.Errorf("row %d - Actual nbig: %v", i, m.NBig)
+		}
+	}
+
+	// the datamodel type is narrower than the column
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic on overflow")
+		}
+	}()
+	type narrow struct {
+		Big uint8 `gorm:"column:big"`
+	}
+	getBinLogData(&e, 0, &narrow{})
+}
@@ -0,0 +1,31 @@
+package parser
+
+// Position is a binlog coordinate, every event before it has been passed to the event handler
+type Position struct {
+	Name string
+	Pos  uint32
+	// GTIDSet is the executed GTID set at this position, empty if GTID mode is off on source db
+	GTIDSet string
+}
+
+// StartMode decides where `StartBinlogListener` starts reading the binlog
+type StartMode string
+
+const (
+	// FromCheckpoint resumes from the position saved by `PositionHandlerInterface`,
+	// falls back to FromNow when there is no saved position
+	FromCheckpoint StartMode = "from_checkpoint"
+	// FromNow starts from the current master position, changes made before are ignored
+	FromNow StartMode = "from_now"
+	// FromPosition starts from `Config.StartPosition`
+	FromPosition StartMode = "from_position"
+)
+
+// PositionHandlerInterface can be optionally implemented by the `EventHandlerInterface` passed to NewEventWrapper
+// to persist the binlog position, so that the parser can resume from where it stopped
+type PositionHandlerInterface interface {
+	// Callback when all events up to `pos` have been handled (fired after XID, rotate & DDL events)
+	OnPosSynced(pos Position) error
+	// LoadPosition returns the last saved position, nil if there is none
+	LoadPosition() (*Position, error)
+}
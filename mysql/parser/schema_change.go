@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"reflect"
+)
+
+// SchemaChange is the drift between a datamodel & its source table, detected after a DDL event
+type SchemaChange struct {
+	Schema string
+	Table  string
+	// Model is the key of the datamodel in ModelMap, see `ModelKey`
+	Model string
+	// Query is the DDL statement
+	Query string
+	// TableDropped is true if the table no longer exists on source db (dropped or renamed)
+	TableDropped bool
+	// AddedColumns are the columns of source table which are not defined in datamodel
+	AddedColumns []ColumnDefinition
+	// MissingColumns are the columns defined in datamodel which no longer exist in source table
+	MissingColumns []string
+}
+
+// ColumnDefinition is the definition of a source column, as found in information_schema.COLUMNS
+type ColumnDefinition struct {
+	Name       string
+	DataType   string // DATA_TYPE, example: "int"
+	ColumnType string // COLUMN_TYPE, example: "int(10) unsigned"
+	Nullable   bool
+	IsPrimary  bool
+}
+
+// SchemaHandlerInterface can be optionally implemented by the `EventHandlerInterface` passed to NewEventWrapper
+// to be notified when a DDL event on source db makes a datamodel stale.
+// Without it, drifts are only logged; rows are still parsed, fields of missing columns are left at zero value
+type SchemaHandlerInterface interface {
+	// Callback after a DDL event (ALTER/RENAME/DROP/CREATE TABLE) on a table defined in datamodels,
+	// only fired if source table & datamodel have drifted
+	OnSchemaChanged(change SchemaChange) error
+}
+
+// detectSchemaChange compares the datamodel of `table` with the current source table definition,
+// returns nil if the table is not defined in datamodels or nothing has drifted
+func (w *baseEventHandler) detectSchemaChange(schemaName string, table string) (*SchemaChange, error) {
+	key := w.modelKey(schemaName, table)
+	if key == "" {
+		return nil, nil
+	}
+	model := w.models[key]
+	res, err := w.canal.Execute(`SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, schemaName, table)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &SchemaChange{Schema: schemaName, Table: table, Model: key}
+	if res.RowNumber() == 0 {
+		change.TableDropped = true
+		return change, nil
+	}
+	modelCols := modelColumns(model)
+	source := make(map[string]bool, res.RowNumber())
+	for i := 0; i < res.RowNumber(); i++ {
+		c := ColumnDefinition{}
+		c.Name, _ = res.GetString(i, 0)
+		c.DataType, _ = res.GetString(i, 1)
+		c.ColumnType, _ = res.GetString(i, 2)
+		nullable, _ := res.GetString(i, 3)
+		key, _ := res.GetString(i, 4)
+		c.Nullable = nullable == "YES"
+		c.IsPrimary = key == "PRI"
+		source[c.Name] = true
+		if !modelCols[c.Name] {
+			change.AddedColumns = append(change.AddedColumns, c)
+		}
+	}
+	for _, name := range modelColumnNames(model) {
+		if !source[name] {
+			change.MissingColumns = append(change.MissingColumns, name)
+		}
+	}
+	if len(change.AddedColumns) == 0 && len(change.MissingColumns) == 0 {
+		return nil, nil
+	}
+	return change, nil
+}
+
+// modelColumns returns the set of column names defined in model's `gorm:"column:xxx"` tags
+func modelColumns(model interface{}) map[string]bool {
+	names := modelColumnNames(model)
+	cols := make(map[string]bool, len(names))
+	for _, name := range names {
+		cols[name] = true
+	}
+	return cols
+}
+
+// modelColumnNames returns the column names defined in model's `gorm:"column:xxx"` tags, in field order
+func modelColumnNames(model interface{}) (names []string) {
+	structType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	for k := 0; k < structType.NumField(); k++ {
+		if isInjected(structType.Field(k).Tag) {
+			continue
+		}
+		if colName, _ := parseTagSetting(structType.Field(k).Tag); colName != "" {
+			names = append(names, colName)
+		}
+	}
+	return
+}
@@ -0,0 +1,259 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/siddontang/go-log/log"
+	cn "github.com/siddontang/go-mysql/canal"
+	"github.com/siddontang/go-mysql/client"
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// number of rows read per query during snapshot, only applies to tables with primary key
+const snapshotBatchSize = 5000
+
+// StartWithSnapshot reads current rows of every table in `ModelMap` (see `Snapshot`),
+// then starts listening from the binlog position recorded at snapshot time, so that no change is lost or duplicated
+func (w *EventHandlerWrapper) StartWithSnapshot() {
+	stopped := w.setRunning()
+	pos, err := w.Snapshot()
+	if err != nil {
+		stopped()
+		w.fail("StartWithSnapshot", err)
+		return
+	}
+	if handler, ok := w.EventHandlerInterface.(PositionHandlerInterface); ok {
+		if err = handler.OnPosSynced(pos); err != nil {
+			stopped()
+			w.fail("StartWithSnapshot", err)
+			return
+		}
+	}
+	w.cfg.StartMode = FromPosition
+	w.cfg.StartPosition = pos
+	w.StartBinlogListener()
+}
+
+// Snapshot reads current rows of every table in `ModelMap` inside one consistent read,
+// every row is passed to `OnInsert` callback.
+// Returns the binlog position at snapshot time
+func (w *EventHandlerWrapper) Snapshot() (pos Position, err error) {
+	canal := w.baseHandler.canal
+	if canal == nil {
+		panic(fmt.Sprint("canal is nil, make sure you have called NewEventWrapper() to create new canal instance"))
+	}
+
+	tables, err := w.snapshotTables()
+	if err != nil {
+		return
+	}
+
+	conn, err := client.Connect(w.cfg.Addr, w.cfg.User, w.cfg.Password, "", func(c *client.Conn) {
+		if w.cfg.TLSConfig != nil {
+			c.SetTLSConfig(w.cfg.TLSConfig)
+		}
+	})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// same as mysqldump --single-transaction --master-data: hold a global read lock
+	// only for the time it takes to open the snapshot & read the binlog position
+	if _, err = conn.Execute("FLUSH TABLES WITH READ LOCK"); err != nil {
+		return
+	}
+	if _, err = conn.Execute("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		conn.Execute("UNLOCK TABLES")
+		return
+	}
+	if _, err = conn.Execute("START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		conn.Execute("UNLOCK TABLES")
+		return
+	}
+	pos, err = masterStatus(conn)
+	if err != nil {
+		conn.Execute("UNLOCK TABLES")
+		return
+	}
+	if _, err = conn.Execute("UNLOCK TABLES"); err != nil {
+		return
+	}
+	log.Infof("snapshot taken at binlog position %v:%v %v", pos.Name, pos.Pos, pos.GTIDSet)
+
+	for _, t := range tables {
+		if err = w.snapshotTable(conn, t); err != nil {
+			conn.Execute("ROLLBACK")
+			return
+		}
+	}
+	_, err = conn.Execute("COMMIT")
+	return
+}
+
+// snapshotTables returns the source tables of every model, filtered by IncludeTableRegex & ExcludeTableRegex
+func (w *EventHandlerWrapper) snapshotTables() (tables []*schema.Table, err error) {
+	canal := w.baseHandler.canal
+	for key := range w.baseHandler.models {
+		query := "SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_NAME = ? AND TABLE_TYPE = 'BASE TABLE'"
+		args := []interface{}{key}
+		if i := strings.IndexByte(key, '.'); i >= 0 {
+			query += " AND TABLE_SCHEMA = ?"
+			args = []interface{}{key[i+1:], key[:i]}
+		}
+		res, err := canal.Execute(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < res.RowNumber(); i++ {
+			schemaName, _ := res.GetString(i, 0)
+			name, _ := res.GetString(i, 1)
+			if w.baseHandler.modelKey(schemaName, name) != key {
+				continue // snapshotted with its schema-qualified model, or not matched by the model
+			}
+			t, err := canal.GetTable(schemaName, name)
+			if err == cn.ErrExcludedTable {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, t)
+		}
+	}
+	return
+}
+
+// snapshotTable reads all rows of table `t` & passes the ones matching its filter (see `RowFilterInterface`) to `OnInsert` callback
+func (w *EventHandlerWrapper) snapshotTable(conn *client.Conn, t *schema.Table) error {
+	key := w.baseHandler.modelKey(t.Schema, t.Name)
+	model := w.baseHandler.models[key]
+	query := fmt.Sprintf("SELECT * FROM `%s`.`%s`", t.Schema, t.Name)
+	batched := len(t.PKColumns) > 0
+	if batched {
+		pks := make([]string, len(t.PKColumns))
+		for i, id := range t.PKColumns {
+			pks[i] = fmt.Sprintf("`%s`", t.Columns[id].Name)
+		}
+		query = fmt.Sprintf("%s ORDER BY %s LIMIT %d OFFSET ", query, strings.Join(pks, ","), snapshotBatchSize)
+	}
+
+	var total int
+	for offset := 0; ; offset += snapshotBatchSize {
+		q := query
+		if batched {
+			q += strconv.Itoa(offset)
+		}
+		res, err := conn.Execute(q)
+		if err != nil {
+			return err
+		}
+		rows := make([][]interface{}, res.RowNumber())
+		for i := range rows {
+			rows[i] = make([]interface{}, res.ColumnNumber())
+			for k := range rows[i] {
+				v, _ := res.GetValue(i, k)
+				if rows[i][k], err = textToBinlogValue(&t.Columns[k], v, w.cfg.UseDecimal); err != nil {
+					return fmt.Errorf("snapshot %v: %v", t, err)
+				}
+			}
+		}
+
+		e := &cn.RowsEvent{Table: t, Action: cn.InsertAction, Rows: rows}
+		for i := range rows {
+			if rec := getBinLogDataLenient(e, i, model); rec != nil && w.baseHandler.match(key, rec) {
+				w.OnInsert(t.Schema, t.Name, rec)
+			}
+		}
+		// each batch is treated as one source transaction
+		if handler, ok := w.EventHandlerInterface.(TransactionHandlerInterface); ok {
+			if err = handler.OnCommit(); err != nil {
+				return err
+			}
+		}
+		total += len(rows)
+		if !batched || len(rows) < snapshotBatchSize {
+			break
+		}
+	}
+	log.Infof("snapshot %v: %d rows", t, total)
+	return nil
+}
+
+// masterStatus reads current binlog position (& GTID set if enabled) from `SHOW MASTER STATUS`
+func masterStatus(conn *client.Conn) (pos Position, err error) {
+	res, err := conn.Execute("SHOW MASTER STATUS")
+	if err != nil {
+		return
+	}
+	if res.RowNumber() == 0 {
+		return pos, fmt.Errorf("binary logging is not enabled on source db")
+	}
+	pos.Name, _ = res.GetString(0, 0)
+	p, _ := res.GetUint(0, 1)
+	pos.Pos = uint32(p)
+	if res.ColumnNumber() > 4 {
+		gtid, _ := res.GetString(0, 4)
+		pos.GTIDSet = strings.Replace(gtid, "\n", "", -1)
+	}
+	return
+}
+
+// textToBinlogValue converts a value read with MySQL text protocol into the same Go type
+// that the binlog decoder would produce for column `col`, so that it can be parsed by `getBinLogData`
+func textToBinlogValue(col *schema.TableColumn, v interface{}, useDecimal bool) (interface{}, error) {
+	raw, ok := v.([]byte)
+	if v == nil || !ok {
+		// NULL, int64, uint64 & float64 values are already decoded
+		if f, isFloat := v.(float64); isFloat && strings.HasPrefix(col.RawType, "float") {
+			return float32(f), nil
+		}
+		return v, nil
+	}
+
+	switch col.Type {
+	case schema.TYPE_DECIMAL:
+		if useDecimal {
+			return decimal.NewFromString(string(raw))
+		}
+		return strconv.ParseFloat(string(raw), 64)
+	case schema.TYPE_ENUM:
+		s := string(raw)
+		for i, e := range col.EnumValues {
+			if e == s {
+				return int64(i + 1), nil
+			}
+		}
+		return int64(0), nil
+	case schema.TYPE_SET:
+		var bits int64
+		if len(raw) > 0 {
+			for _, s := range strings.Split(string(raw), ",") {
+				for i, e := range col.SetValues {
+					if e == s {
+						bits |= 1 << uint(i)
+					}
+				}
+			}
+		}
+		return bits, nil
+	case schema.TYPE_BIT:
+		buf := make([]byte, 8)
+		copy(buf[8-len(raw):], raw)
+		return int64(binary.BigEndian.Uint64(buf)), nil
+	case schema.TYPE_STRING:
+		// binlog decodes BLOB/TEXT into bytes & CHAR/VARCHAR into string
+		if strings.Contains(col.RawType, "blob") || strings.Contains(col.RawType, "text") {
+			return raw, nil
+		}
+		return string(raw), nil
+	case schema.TYPE_JSON, schema.TYPE_POINT:
+		return raw, nil
+	default:
+		return string(raw), nil
+	}
+}
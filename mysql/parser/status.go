@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"time"
+
+	"github.com/siddontang/go-log/log"
+)
+
+// State of the binlog listener
+type State string
+
+const (
+	// Running is listening to binlog (or taking a snapshot)
+	Running State = "running"
+	// Stopped has been closed, or has not been started
+	Stopped State = "stopped"
+	// Failed has stopped on error, see `Status.LastError`
+	Failed State = "failed"
+)
+
+// Status is a snapshot of the binlog listener's state
+type Status struct {
+	State State
+	// Position is the last binlog position handled
+	Position Position
+	// Delay is the replication lag behind master, in seconds
+	Delay uint32
+	// LastError is the error which stopped the listener, if any
+	LastError     string
+	LastErrorTime *time.Time
+}
+
+// Status returns the current state of the binlog listener
+func (w *EventHandlerWrapper) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := Status{State: Stopped}
+	if w.running {
+		status.State = Running
+	} else if w.lastErr != nil {
+		status.State = Failed
+	}
+	if w.lastErr != nil {
+		errTime := w.lastErrTime
+		status.LastError = w.lastErr.Error()
+		status.LastErrorTime = &errTime
+	}
+	if canal := w.baseHandler.canal; canal != nil {
+		pos := canal.SyncedPosition()
+		status.Position = Position{Name: pos.Name, Pos: pos.Pos}
+		if set := canal.SyncedGTIDSet(); set != nil {
+			status.Position.GTIDSet = set.String()
+		}
+		status.Delay = canal.GetDelay()
+	}
+	return status
+}
+
+// setRunning marks the listener as running, returns a func to mark it as stopped
+func (w *EventHandlerWrapper) setRunning() func() {
+	w.mu.Lock()
+	w.running = true
+	w.lastErr = nil
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		w.running = false
+		w.mu.Unlock()
+	}
+}
+
+// fail logs & records the error which stopped the listener
+func (w *EventHandlerWrapper) fail(caller string, err error) {
+	log.Errorf("%v: %v", caller, err)
+	w.mu.Lock()
+	w.lastErr = err
+	w.lastErrTime = time.Now()
+	w.mu.Unlock()
+}
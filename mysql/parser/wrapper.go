@@ -3,8 +3,12 @@ package parser
 import (
 	"crypto/tls"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/siddontang/go-log/log"
 	cn "github.com/siddontang/go-mysql/canal"
+	"github.com/siddontang/go-mysql/mysql"
 )
 
 // Config object, see https://pkg.go.dev/github.com/siddontang/go-mysql@v1.1.0/canal
@@ -18,9 +22,15 @@ type Config struct {
 	UseDecimal        bool
 	Charset           string
 	TLSConfig         *tls.Config
+	// StartMode defaults to FromCheckpoint
+	StartMode StartMode
+	// StartPosition is only used with FromPosition
+	StartPosition Position
 }
 
-// ModelMap maps the actual table name & the table structure
+// ModelMap maps the actual table name & the table structure,
+// the key is either "schema.table", or "table" to match the table of that name in any schema
+// (a schema-qualified key takes precedence, see `ModelKey`)
 //
 // Example:
 // "User" table on RDBMS has 2 column id & name, correspond to TableModel.ID & TableModel.Name
@@ -30,11 +40,28 @@ type Config struct {
 // }}
 type ModelMap = map[string]interface{}
 
+// ModelKey returns the key of the model of source table `schema`.`table` in `models`:
+// "schema.table" if it is defined, "table" if it is defined, empty string otherwise
+func ModelKey(models ModelMap, schema string, table string) string {
+	if key := schema + "." + table; models[key] != nil {
+		return key
+	}
+	if models[table] != nil {
+		return table
+	}
+	return ""
+}
+
 // EventHandlerWrapper is a wrapper for canal's event handler, implements `EventHandlerInterface`
 type EventHandlerWrapper struct {
 	baseHandler baseEventHandler
 	cfg         Config
 	EventHandlerInterface
+	// listener state, see `Status`
+	mu          sync.Mutex
+	running     bool
+	lastErr     error
+	lastErrTime time.Time
 }
 
 // NewEventWrapper creates new instance of `EventHandlerWrapper`
@@ -57,18 +84,19 @@ func NewEventWrapper(models ModelMap, cfg Config, handler EventHandlerInterface)
 	}
 
 	return &EventHandlerWrapper{
-		baseEventHandler{
+		baseHandler: baseEventHandler{
 			cn.DummyEventHandler{},
 			handler,
 			models,
 			canal,
+			nil,
 		},
-		cfg,
-		handler,
+		cfg:                   cfg,
+		EventHandlerInterface: handler,
 	}
 }
 
-// StartBinlogListener starts listening from the binlog position directly, ignore mysqldump
+// StartBinlogListener starts listening from the binlog position directly (decided by `Config.StartMode`), ignore mysqldump
 func (w *EventHandlerWrapper) StartBinlogListener() {
 
 	canal := w.baseHandler.canal
@@ -76,15 +104,59 @@ func (w *EventHandlerWrapper) StartBinlogListener() {
 		panic(fmt.Sprint("canal is nil, make sure you have called NewEventWrapper() to create new canal instance"))
 	}
 	canal.SetEventHandler(&w.baseHandler)
+	defer w.setRunning()()
 
-	coords, err := canal.GetMasterPos()
-	if err == nil {
-		canal.RunFrom(coords)
+	pos, err := w.startPosition()
+	if err != nil {
+		w.fail("StartBinlogListener", err)
+		return
+	}
+	if pos.GTIDSet != "" {
+		set, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, pos.GTIDSet)
+		if err != nil {
+			w.fail("StartBinlogListener", fmt.Errorf("invalid GTID set %v: %v", pos.GTIDSet, err))
+			return
+		}
+		err = canal.StartFromGTID(set)
+	} else {
+		err = canal.RunFrom(mysql.Position{Name: pos.Name, Pos: pos.Pos})
+	}
+	if err != nil {
+		w.fail("StartBinlogListener", err)
+	}
+}
+
+// startPosition resolves the binlog position to start from
+func (w *EventHandlerWrapper) startPosition() (Position, error) {
+	switch w.cfg.StartMode {
+	case FromPosition:
+		if w.cfg.StartPosition.Name == "" && w.cfg.StartPosition.GTIDSet == "" {
+			return Position{}, fmt.Errorf("start position is not defined")
+		}
+		return w.cfg.StartPosition, nil
+	case FromCheckpoint, "":
+		if handler, ok := w.EventHandlerInterface.(PositionHandlerInterface); ok {
+			pos, err := handler.LoadPosition()
+			if err != nil {
+				return Position{}, err
+			}
+			if pos != nil {
+				log.Infof("resuming from checkpoint %v:%v %v", pos.Name, pos.Pos, pos.GTIDSet)
+				return *pos, nil
+			}
+		}
+	}
+	coords, err := w.baseHandler.canal.GetMasterPos()
+	if err != nil {
+		return Position{}, err
 	}
+	return Position{Name: coords.Name, Pos: coords.Pos}, nil
 }
 
 // Close event
 func (w *EventHandlerWrapper) Close() {
 	w.baseHandler.canal.Close()
+	w.mu.Lock()
 	w.baseHandler.canal = nil
+	w.mu.Unlock()
 }
@@ -13,12 +13,15 @@ import (
 	"mysql2mssql/server/param"
 	"mysql2mssql/syncer"
 	"os"
+	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
-	dynamicstruct "github.com/ompluscator/dynamic-struct"
 	"github.com/siddontang/go-log/log"
+	"github.com/siddontang/go-mysql/client"
 )
 
 // The API for interacting with source/target databases
@@ -28,16 +31,48 @@ type API struct {
 	eventWrapper *parser.EventHandlerWrapper
 	syncer       *syncer.Syncer
 	logStore     *syncer.Store
+	// see param.StartParserRequest
+	schemaChangePolicy string
+	useDecimal         bool
+	// encrypts the saved Parser & Syncer requests, see `SetSecretKey`
+	secretKey []byte
+	// source schemas, discriminator & transformations of each datamodel, see `ModelKey` & `process`
+	routes   map[string]*route
+	routesMu sync.RWMutex
 }
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
 const bucket = "API"
 
-// Put defines what table/columns to Parse & Sync
+var errLogStoreNotInitialized = errors.New("Log Store is not initialized, please call /parser/start first")
+
+// schema change policies, see param.StartParserRequest
+const (
+	pausePolicy     = "pause"
+	extendPolicy    = "extend"
+	propagatePolicy = "propagate"
+)
+
+// Put defines what table/columns to Parse & Sync,
+// the table is resumed if it was paused after a schema change
 func (a *API) Put(p param.StructRequest) (strct interface{}, err error) {
-	strct = generateStruct(p.Columns)
-	(*a.DataModels)[p.Table] = strct
+	strct = generateStruct(p)
+	r, err := newRoute(p, strct)
+	if err != nil {
+		return nil, err
+	}
+	a.setRoute(p.Table, r)
+	if a.logStore != nil {
+		a.logStore.SetTarget(p.Table, targetTable(p))
+		// same map as DataModels, but guarded against the running syncer
+		a.logStore.SetModel(p.Table, strct)
+		if err = a.logStore.Resume(p.Table); err != nil {
+			return
+		}
+	} else {
+		(*a.DataModels)[p.Table] = strct
+	}
 	err = a.storeToDB(p)
 	return
 }
@@ -47,12 +82,165 @@ func (a *API) Get(tabName string) (strct interface{}) {
 	return (*a.DataModels)[tabName]
 }
 
+// DDL renders the T-SQL `create table` statement of a saved table structure
+func (a *API) DDL(tabName string) (string, error) {
+	strct := (*a.DataModels)[tabName]
+	if strct == nil {
+		return "", fmt.Errorf("table structure %v is not defined", tabName)
+	}
+	return syncer.BuildCreateTableStatement(a.target(tabName), strct), nil
+}
+
+// Discover generates table structures from the column definitions in source db's information_schema,
+// the structures are also saved (see `Put`) if `p.Save` is true
+func (a *API) Discover(p param.DiscoverStructRequest) (structs []param.StructRequest, err error) {
+	tableRegex := regexp.MustCompile("^(?:.*)$")
+	if p.TableRegex != "" {
+		if tableRegex, err = regexp.Compile("^(?:" + p.TableRegex + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	tlsConfig := createTLSConfig(p.TLSConfig.ServerName, p.TLSConfig.ServerCA, p.TLSConfig.ClientCert, p.TLSConfig.ClientKey)
+	conn, err := client.Connect(p.Addr, p.User, p.Password, "", func(c *client.Conn) {
+		if tlsConfig != nil {
+			c.SetTLSConfig(tlsConfig)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	res, err := conn.Execute(`SELECT c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE, c.COLUMN_TYPE, c.IS_NULLABLE, c.COLUMN_KEY
+		FROM information_schema.COLUMNS c
+		JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+		WHERE c.TABLE_SCHEMA = ? AND t.TABLE_TYPE = 'BASE TABLE'
+		ORDER BY c.TABLE_NAME, c.ORDINAL_POSITION`, p.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := map[string]bool{}
+	for _, col := range p.ExcludeColumns {
+		excluded[col] = true
+	}
+	for i := 0; i < res.RowNumber(); i++ {
+		table, _ := res.GetString(i, 0)
+		if !tableRegex.MatchString(table) {
+			continue
+		}
+		name, _ := res.GetString(i, 1)
+		if excluded[name] || excluded[table+"."+name] {
+			continue
+		}
+		dataType, _ := res.GetString(i, 2)
+		columnType, _ := res.GetString(i, 3)
+		nullable, _ := res.GetString(i, 4)
+		key, _ := res.GetString(i, 5)
+		mType, err := db.ParseColumnType(dataType, columnType, nullable == "YES", p.UseDecimal)
+		if err != nil {
+			return nil, fmt.Errorf("%v.%v: %v, use exclude_columns to skip it", table, name, err)
+		}
+
+		if p.Qualified {
+			table = p.Schema + "." + table
+		}
+		if len(structs) == 0 || structs[len(structs)-1].Table != table {
+			structs = append(structs, param.StructRequest{Table: table})
+		}
+		s := &structs[len(structs)-1]
+		s.Columns = append(s.Columns, param.Column{Name: name, Type: mType, IsPrimary: key == "PRI"})
+	}
+	if len(structs) == 0 {
+		return nil, fmt.Errorf("no table found in schema %v matching %v", p.Schema, tableRegex)
+	}
+
+	if p.Save {
+		for _, s := range structs {
+			if _, err = a.Put(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return
+}
+
 // StartParser inits Parser to listen to changes on source db & log changes to Log Store
 func (a *API) StartParser(p param.StartParserRequest) {
-	a.logStore = syncer.NewStore(a.DBInterface, *a.DataModels)
+	a.openLogStore()
+	a.schemaChangePolicy = p.SchemaChangePolicy
+	a.useDecimal = p.UseDecimal
+	if p.PreserveOrder {
+		if err := a.logStore.EnableJournal(); err != nil {
+			panic(err)
+		}
+	}
 	w := parser.NewEventWrapper(*a.DataModels, createParserConfig(p), a)
-	go w.StartBinlogListener()
+	if p.Snapshot {
+		go w.StartWithSnapshot()
+	} else {
+		go w.StartBinlogListener()
+	}
 	a.eventWrapper = w
+	if err := a.saveConfig(parserKey, p); err != nil {
+		log.Errorf("Save parser config error: %v", err)
+	}
+}
+
+// openLogStore creates the Log Store of the datamodels
+func (a *API) openLogStore() {
+	a.logStore = syncer.NewStore(a.DBInterface, *a.DataModels)
+	for table := range *a.DataModels {
+		a.logStore.SetTarget(table, a.target(table))
+	}
+}
+
+// SchemaChanges returns the history of source schema changes detected by Parser
+func (a *API) SchemaChanges() ([]syncer.SchemaChange, error) {
+	if a.logStore == nil {
+		return nil, errLogStoreNotInitialized
+	}
+	return a.logStore.SchemaChanges()
+}
+
+// DeadLetters returns the records of a table which failed to apply to target db
+func (a *API) DeadLetters(tabName string) ([]*syncer.DeadLetter, error) {
+	if a.logStore == nil {
+		return nil, errLogStoreNotInitialized
+	}
+	return a.logStore.DeadLetters(tabName)
+}
+
+// DeadLetter returns a dead-lettered record, nil if not found
+func (a *API) DeadLetter(tabName string, id string) (*syncer.DeadLetter, error) {
+	if a.logStore == nil {
+		return nil, errLogStoreNotInitialized
+	}
+	return a.logStore.DeadLetter(tabName, id)
+}
+
+// EditDeadLetter replaces the data of a dead-lettered record, returns nil if not found
+func (a *API) EditDeadLetter(tabName string, id string, p param.DeadLetterRequest) (*syncer.DeadLetter, error) {
+	if a.logStore == nil {
+		return nil, errLogStoreNotInitialized
+	}
+	return a.logStore.EditDeadLetter(tabName, id, p.Old, p.New)
+}
+
+// RetryDeadLetter applies a dead-lettered record again, it is removed on success
+func (a *API) RetryDeadLetter(tabName string, id string) error {
+	if a.syncer == nil {
+		return errors.New("Syncer is not initialized, please call /syncer/start first")
+	}
+	return a.syncer.RetryDeadLetter(tabName, id)
+}
+
+// DiscardDeadLetter removes a dead-lettered record
+func (a *API) DiscardDeadLetter(tabName string, id string) error {
+	if a.logStore == nil {
+		return errLogStoreNotInitialized
+	}
+	return a.logStore.DeleteDeadLetter(tabName, id)
 }
 
 // StopParser stops the Parser listener
@@ -62,6 +250,9 @@ func (a *API) StopParser() (err error) {
 	}
 	a.eventWrapper.Close()
 	a.eventWrapper = nil
+	if err := a.markConfigStopped(parserKey); err != nil {
+		log.Errorf("Save parser config error: %v", err)
+	}
 	return
 }
 
@@ -117,7 +308,13 @@ func (a *API) LoadDataModels() (err error) {
 		if err != nil {
 			return err
 		}
-		(*a.DataModels)[string(entry.Key)] = generateStruct(p.Columns)
+		strct := generateStruct(*p)
+		r, err := newRoute(*p, strct)
+		if err != nil {
+			return fmt.Errorf("datamodel %v: %v", entry.Key, err)
+		}
+		a.setRoute(entry.Key, r)
+		(*a.DataModels)[entry.Key] = strct
 	}
 	return nil
 }
@@ -125,7 +322,16 @@ func (a *API) LoadDataModels() (err error) {
 // StartSyncer to periodically sync changes recorded in log store to target DB
 func (a *API) StartSyncer(p param.StartSyncerRequest) {
 	a.syncer = a.createSyncer(p)
+	if p.CreateTables {
+		if err := a.syncer.CreateTables(); err != nil {
+			a.syncer.Close()
+			panic(err)
+		}
+	}
 	a.syncer.Schedule()
+	if err := a.saveConfig(syncerKey, p); err != nil {
+		log.Errorf("Save syncer config error: %v", err)
+	}
 }
 
 // StopSyncer stops the syncing job
@@ -134,6 +340,9 @@ func (a *API) StopSyncer() (err error) {
 		return err
 	}
 	a.syncer.Close()
+	if err := a.markConfigStopped(syncerKey); err != nil {
+		log.Errorf("Save syncer config error: %v", err)
+	}
 	return
 }
 
@@ -150,6 +359,12 @@ func createParserConfig(param param.StartParserRequest) parser.Config {
 		Password:          param.Password,
 		UseDecimal:        param.UseDecimal,
 		TLSConfig:         createTLSConfig(param.TLSConfig.ServerName, param.TLSConfig.ServerCA, param.TLSConfig.ClientCert, param.TLSConfig.ClientKey),
+		StartMode:         parser.StartMode(param.StartFrom),
+		StartPosition: parser.Position{
+			Name:    param.Position.File,
+			Pos:     param.Position.Pos,
+			GTIDSet: param.Position.GTIDSet,
+		},
 	}
 }
 
@@ -201,21 +416,111 @@ func (a *API) createSyncer(param param.StartSyncerRequest) *syncer.Syncer {
 	if param.Log != 0 {
 		tDBConf.Log = param.Log
 	}
+	tDBConf.BatchSize = param.BatchSize
+	tDBConf.ApplyMode = syncer.ApplyMode(param.ApplyMode)
+	tDBConf.MaxRetries = param.MaxRetries
+	tDBConf.RetryInterval = time.Duration(param.RetryIntervalMs) * time.Millisecond
+	tDBConf.MaxRetryInterval = time.Duration(param.MaxRetryIntervalMs) * time.Millisecond
+	tDBConf.RetryJitter = param.RetryJitter
 	return syncer.NewSyncer(tDBConf, param.Interval, a.logStore)
 }
 
-func generateStruct(cols []param.Column) interface{} {
-	d := dynamicstruct.NewStruct()
-	for _, c := range cols {
+// generateStruct builds the datamodel struct of table structure `p`, its fields are in the order of the columns
+// (followed by the JSON projections & the discriminator) so that the column order of generated DDL is stable
+func generateStruct(p param.StructRequest) interface{} {
+	var fields []reflect.StructField
+	index := make(map[string]int, len(p.Columns))
+	addField := func(name string, value interface{}, tag string) {
+		f := reflect.StructField{Name: name, Type: reflect.TypeOf(value), Tag: reflect.StructTag(tag)}
+		// a field defined twice is replaced
+		if i, ok := index[name]; ok {
+			fields[i] = f
+			return
+		}
+		index[name] = len(fields)
+		fields = append(fields, f)
+	}
+	for _, c := range p.Columns {
 		t := db.Convert(c.Type)
 		var prm string
 		if c.IsPrimary {
 			prm = ";primaryKey"
 		}
+		tag := fmt.Sprintf(`gorm:"column:%s%s"`, c.Name, prm)
+		if c.TargetName != "" {
+			tag += fmt.Sprintf(` target:"%s"`, c.TargetName)
+		}
 		// capitalize first letter to create exported field name for reflection access
-		d.AddField(strings.Title(c.Name), t, fmt.Sprintf(`gorm:"column:%s%s"`, c.Name, prm))
+		addField(strings.Title(c.Name), t, tag)
+	}
+	for _, c := range p.Columns {
+		if c.JSON == nil {
+			continue
+		}
+		for _, path := range c.JSON.Paths {
+			t := path.Type
+			if t == 0 {
+				t = db.NullableString
+			}
+			// not read from source table, set in `process`
+			tag := fmt.Sprintf(`gorm:"column:%s" source:"-"`, path.Name)
+			if path.TargetName != "" {
+				tag += fmt.Sprintf(` target:"%s"`, path.TargetName)
+			}
+			addField(strings.Title(path.Name), db.Convert(t), tag)
+		}
+	}
+	if c := p.Discriminator; c != nil {
+		t := c.Type
+		if t == 0 {
+			t = db.String
+		}
+		// not read from source table, set in `process`
+		tag := fmt.Sprintf(`gorm:"column:%s;primaryKey" source:"-"`, c.Name)
+		if c.TargetName != "" {
+			tag += fmt.Sprintf(` target:"%s"`, c.TargetName)
+		}
+		addField(strings.Title(c.Name), db.Convert(t), tag)
+	}
+	return reflect.New(reflect.StructOf(fields)).Interface()
+}
+
+// targetTable returns the quoted name of the table in target db of a table structure,
+// a schema-qualified source table is synced to the target schema of the same name by default
+func targetTable(p param.StructRequest) string {
+	targetSchema, table := p.TargetSchema, p.Table
+	if i := strings.IndexByte(table, '.'); i >= 0 {
+		if targetSchema == "" {
+			targetSchema = table[:i]
+		}
+		table = table[i+1:]
+	}
+	if p.TargetTable != "" {
+		table = p.TargetTable
+	}
+	return syncer.TableName(targetSchema, table)
+}
+
+// target returns the quoted name of the table in target db of a saved table structure
+func (a *API) target(tabName string) string {
+	p, err := a.loadStruct(tabName)
+	if err != nil || p == nil {
+		return targetTable(param.StructRequest{Table: tabName})
+	}
+	return targetTable(*p)
+}
+
+// loadStruct returns a saved table structure, nil if not found
+func (a *API) loadStruct(tabName string) (*param.StructRequest, error) {
+	b, err := a.DBInterface.Get(bucket, tabName)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	p := &param.StructRequest{}
+	if err = json.Unmarshal(b, p); err != nil {
+		return nil, err
 	}
-	return d.Build().New()
+	return p, nil
 }
 
 func (a *API) storeToDB(param param.StructRequest) (err error) {
@@ -223,12 +528,70 @@ func (a *API) storeToDB(param param.StructRequest) (err error) {
 	return a.DBInterface.Put(bucket, param.Table, bytes, 0)
 }
 
+// applySchemaChange updates the datamodel of a drifted table according to the schema change policy,
+// returns an error if the table must be paused instead
+func (a *API) applySchemaChange(change parser.SchemaChange) error {
+	policy := a.schemaChangePolicy
+	if policy == "" || policy == pausePolicy {
+		return errors.New("update the datamodel with /struct/put to resume")
+	}
+	if change.TableDropped {
+		return errors.New("source table no longer exists")
+	}
+	saved, err := a.loadStruct(change.Model)
+	if err != nil || saved == nil {
+		return fmt.Errorf("datamodel is not saved: %v", err)
+	}
+	p := *saved
+
+	missing := map[string]bool{}
+	for _, name := range change.MissingColumns {
+		missing[name] = true
+	}
+	var cols []param.Column
+	for _, c := range p.Columns {
+		if !missing[c.Name] {
+			cols = append(cols, c)
+		} else if c.IsPrimary {
+			return fmt.Errorf("primary key column %v no longer exists", c.Name)
+		}
+	}
+	for _, c := range change.AddedColumns {
+		if c.IsPrimary {
+			return fmt.Errorf("new primary key column %v", c.Name)
+		}
+		mType, err := db.ParseColumnType(c.DataType, c.ColumnType, c.Nullable, a.useDecimal)
+		if err != nil {
+			return fmt.Errorf("%v: %v", c.Name, err)
+		}
+		cols = append(cols, param.Column{Name: c.Name, Type: mType})
+	}
+	p.Columns = cols
+
+	oldModel := (*a.DataModels)[change.Model]
+	newModel, err := a.Put(p)
+	if err != nil {
+		return err
+	}
+	if policy == propagatePolicy {
+		for _, stmt := range syncer.BuildAlterTableStatements(targetTable(p), oldModel, newModel) {
+			if err = a.logStore.LogAlter(change.Model, stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 ////////////////////////////////////////////////////////////////
-// TODO: use schema
 
 // OnInsert implements EventHandlerInterface
 func (a *API) OnInsert(schemaName string, tableName string, rec interface{}) {
-	err := a.logStore.LogInsert(tableName, rec)
+	key := a.ModelKey(schemaName, tableName)
+	rec, err := a.process(key, schemaName, rec)
+	if err == nil {
+		err = a.logStore.LogInsert(key, rec)
+	}
 	if err != nil {
 		log.Errorf("Error during insert: %v\n", err.Error())
 	}
@@ -236,7 +599,14 @@ func (a *API) OnInsert(schemaName string, tableName string, rec interface{}) {
 
 // OnUpdate implements EventHandlerInterface
 func (a *API) OnUpdate(schemaName string, tableName string, oldRec interface{}, newRec interface{}) {
-	err := a.logStore.LogUpdate(tableName, oldRec, newRec)
+	key := a.ModelKey(schemaName, tableName)
+	oldRec, err := a.process(key, schemaName, oldRec)
+	if err == nil {
+		newRec, err = a.process(key, schemaName, newRec)
+	}
+	if err == nil {
+		err = a.logStore.LogUpdate(key, oldRec, newRec)
+	}
 	if err != nil {
 		log.Errorf("Error during update: %v\n", err.Error())
 	}
@@ -244,10 +614,74 @@ func (a *API) OnUpdate(schemaName string, tableName string, oldRec interface{},
 
 // OnDelete implements EventHandlerInterface
 func (a *API) OnDelete(schemaName string, tableName string, rec interface{}) {
-	err := a.logStore.LogDelete(tableName, rec)
+	key := a.ModelKey(schemaName, tableName)
+	rec, err := a.process(key, schemaName, rec)
+	if err == nil {
+		err = a.logStore.LogDelete(key, rec)
+	}
 	if err != nil {
 		log.Printf("Error during delete: %v\n", err.Error())
 	}
 }
 
+// OnSchemaChanged implements SchemaHandlerInterface, applies the schema change policy
+// & records the change in Log Store
+func (a *API) OnSchemaChanged(change parser.SchemaChange) error {
+	c := syncer.SchemaChange{
+		Time:           time.Now(),
+		Schema:         change.Schema,
+		Table:          change.Table,
+		Model:          change.Model,
+		Query:          change.Query,
+		TableDropped:   change.TableDropped,
+		MissingColumns: change.MissingColumns,
+		Policy:         a.schemaChangePolicy,
+	}
+	for _, col := range change.AddedColumns {
+		c.AddedColumns = append(c.AddedColumns, col.Name)
+	}
+	if c.Policy == "" {
+		c.Policy = pausePolicy
+	}
+
+	if err := a.applySchemaChange(change); err != nil {
+		c.Result = "paused: " + err.Error()
+		log.Warnf("table %v is paused after schema change (%v): %v", change.Model, change.Query, err)
+		if err = a.logStore.Pause(change.Model, err.Error()); err != nil {
+			return err
+		}
+	} else {
+		c.Result = "applied"
+		log.Infof("datamodel of %v is updated after schema change (%v)", change.Model, change.Query)
+	}
+	return a.logStore.LogSchemaChange(c)
+}
+
+// OnCommit implements TransactionHandlerInterface, marks the end of a source transaction in Log Store
+func (a *API) OnCommit() error {
+	return a.logStore.LogCommit()
+}
+
+// OnPosSynced implements PositionHandlerInterface, saves the binlog position as checkpoint in Log Store
+func (a *API) OnPosSynced(pos parser.Position) error {
+	return a.logStore.SaveCheckpoint(syncer.Checkpoint{
+		Name:    pos.Name,
+		Pos:     pos.Pos,
+		GTIDSet: pos.GTIDSet,
+	})
+}
+
+// LoadPosition implements PositionHandlerInterface, returns the checkpoint saved in Log Store
+func (a *API) LoadPosition() (*parser.Position, error) {
+	c, err := a.logStore.LoadCheckpoint()
+	if err != nil || c == nil {
+		return nil, err
+	}
+	return &parser.Position{
+		Name:    c.Name,
+		Pos:     c.Pos,
+		GTIDSet: c.GTIDSet,
+	}, nil
+}
+
 ////////////////////////////////////////////////////////////////
@@ -0,0 +1,286 @@
+package API
+
+import (
+	stdjson "encoding/json"
+	"mysql2mssql/db"
+	"mysql2mssql/mysql/parser"
+	"mysql2mssql/server/param"
+	"mysql2mssql/syncer"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDDLTargetNames(t *testing.T) {
+	a := &API{DataModels: &parser.ModelMap{}, DBInterface: db.UseInmemDB()}
+	_, err := a.Put(param.StructRequest{
+		Table:        "staff",
+		TargetSchema: "staging",
+		TargetTable:  "tbl_Staff",
+		Columns: []param.Column{
+			{Name: "staff_id", Type: db.Int, IsPrimary: true, TargetName: "StaffID"},
+			{Name: "first_name", Type: db.NullableString},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	expected := "create table [staging].[tbl_Staff] ([StaffID] bigint not null,[first_name] nvarchar(max) null," +
+		"constraint [PK_tbl_Staff] primary key ([StaffID]));"
+	if actual, err := a.DDL("staff"); actual != expected || err != nil {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s %v\n\n", expected, actual, err)
+	}
+}
+
+// columns & primary key columns of DDL are in the order of the table structure, whenever its struct is generated
+func TestDDLColumnOrder(t *testing.T) {
+	a := &API{DataModels: &parser.ModelMap{}, DBInterface: db.UseInmemDB()}
+	p := param.StructRequest{
+		Table: "film_actor",
+		Columns: []param.Column{
+			{Name: "film_id", Type: db.Int, IsPrimary: true},
+			{Name: "last_update", Type: db.DateTime},
+			{Name: "actor_id", Type: db.Int, IsPrimary: true},
+			{Name: "role", Type: db.NullableString},
+		},
+	}
+	expected := "create table [film_actor] ([film_id] bigint not null,[last_update] datetime2 not null,[actor_id] bigint not null," +
+		"[role] nvarchar(max) null,constraint [PK_film_actor] primary key ([film_id],[actor_id]));"
+	for i := 0; i < 10; i++ {
+		if _, err := a.Put(p); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if actual, err := a.DDL("film_actor"); actual != expected || err != nil {
+			t.Fatalf("Expected: \n\n%s\n\n Actual: \n\n%s %v\n\n", expected, actual, err)
+		}
+	}
+}
+
+func TestTargetTable(t *testing.T) {
+	targets := map[string]param.StructRequest{
+		"[staff]":            {Table: "staff"},
+		"[tenant1].[staff]":  {Table: "tenant1.staff"},
+		"[dbo].[staff]":      {Table: "tenant1.staff", TargetSchema: "dbo"},
+		"[tenant1].[Staff1]": {Table: "tenant1.staff", TargetTable: "Staff1"},
+	}
+	for expected, p := range targets {
+		if actual := targetTable(p); actual != expected {
+			t.Errorf("%+v - Expected: %v, Actual: %v", p, expected, actual)
+		}
+	}
+}
+
+func TestDiscriminator(t *testing.T) {
+	a := &API{DataModels: &parser.ModelMap{}, DBInterface: db.UseInmemDB()}
+	_, err := a.Put(param.StructRequest{
+		Table:         "staff",
+		SchemaRegex:   `tenant_(\d+)`,
+		Discriminator: &param.Discriminator{Name: "tenant_id", Type: db.Int, Value: "$1"},
+		Columns:       []param.Column{{Name: "staff_id", Type: db.Int, IsPrimary: true}},
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	a.logStore = syncer.NewStore(a.DBInterface, *a.DataModels)
+
+	if key := a.ModelKey("tenant_42", "staff"); key != "staff" {
+		t.Errorf("Expected tenant_42.staff to match datamodel staff, Actual: %q", key)
+	}
+	if key := a.ModelKey("sakila", "staff"); key != "" {
+		t.Errorf("Expected sakila.staff not to match, Actual: %q", key)
+	}
+
+	rec := reflect.ValueOf(a.Get("staff")).Elem()
+	rec.FieldByName("Staff_id").SetInt(1)
+	actual, err := a.process("staff", "tenant_42", rec.Interface())
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if id := reflect.ValueOf(actual).FieldByName("Tenant_id").Int(); id != 42 {
+		t.Errorf("Expected tenant_id 42, Actual: %v", id)
+	}
+	if id := rec.FieldByName("Tenant_id").Int(); id != 0 {
+		t.Errorf("Expected the parsed record to be left unchanged, Actual tenant_id: %v", id)
+	}
+
+	expected := "create table [staff] ([staff_id] bigint not null,[tenant_id] bigint not null," +
+		"constraint [PK_staff] primary key ([staff_id],[tenant_id]));"
+	if ddl, _ := a.DDL("staff"); ddl != expected {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, ddl)
+	}
+}
+
+// newTestAPI returns an API routing datamodel `p`, and an addressable record of its struct
+func newTestAPI(t *testing.T, p param.StructRequest) (*API, reflect.Value) {
+	strct := generateStruct(p)
+	r, err := newRoute(p, strct)
+	if err != nil {
+		t.Fatalf("newRoute failed: %v", err)
+	}
+	a := &API{}
+	a.setRoute(p.Table, r)
+	return a, reflect.ValueOf(strct).Elem()
+}
+
+func TestTransforms(t *testing.T) {
+	p := param.StructRequest{
+		Table: "staff",
+		Columns: []param.Column{
+			{Name: "staff_id", Type: db.Int, IsPrimary: true},
+			{Name: "email", Type: db.NullableString, Transforms: []param.Transform{{Name: "trim"}, {Name: "mask_email"}}},
+			{Name: "last_update", Type: db.NullableDateTime, Transforms: []param.Transform{{Name: "zero_date_to_null"}}},
+		},
+	}
+	a, rec := newTestAPI(t, p)
+	email, zero := " john@mail.com ", time.Time{}
+	rec.FieldByName("Email").Set(reflect.ValueOf(&email))
+	rec.FieldByName("Last_update").Set(reflect.ValueOf(&zero))
+
+	actual, err := a.process("staff", "sakila", rec.Interface())
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	v := reflect.ValueOf(actual)
+	if e := v.FieldByName("Email").Interface().(*string); e == nil || *e != "j***@mail.com" {
+		t.Errorf("Expected email j***@mail.com, Actual: %v", e)
+	}
+	if d := v.FieldByName("Last_update").Interface().(*time.Time); d != nil {
+		t.Errorf("Expected last_update nil, Actual: %v", d)
+	}
+	if email != " john@mail.com " {
+		t.Errorf("Expected the parsed record to be left unchanged, Actual email: %q", email)
+	}
+
+	store := param.StructRequest{
+		Table:   "store",
+		Columns: []param.Column{{Name: "store_id", Type: db.Int, Transforms: []param.Transform{{Name: "unknown"}}}},
+	}
+	if _, err := newRoute(store, generateStruct(store)); err == nil {
+		t.Error("Expected error on unknown transformation")
+	}
+}
+
+func TestJSONColumns(t *testing.T) {
+	p := param.StructRequest{
+		Table: "customer",
+		Columns: []param.Column{
+			{Name: "customer_id", Type: db.Int, IsPrimary: true},
+			{Name: "profile", Type: db.NullableJson, JSON: &param.JSONOptions{
+				Validate: true,
+				Paths: []param.JSONPath{
+					{Path: "$.address.city", Name: "city"},
+					{Path: "$.tags[1]", Name: "tag"},
+					{Path: "$.\"visit count\"", Name: "visits", Type: db.NullableInt},
+					{Path: "$.vip", Name: "vip", Type: db.NullableBool},
+					{Path: "$.balance", Name: "balance", Type: db.NullableDecimal},
+					{Path: "$.address", Name: "address", Type: db.NullableJson},
+					{Path: "$.missing", Name: "missing"},
+				},
+			}},
+		},
+	}
+	a, rec := newTestAPI(t, p)
+	profile := stdjson.RawMessage(`{"address":{"city":"Lethbridge","zip":"T1H"},"tags":["a","b"],"visit count":3,"vip":true,"balance":12.50}`)
+	rec.FieldByName("Profile").Set(reflect.ValueOf(&profile))
+	actual, err := a.process("customer", "sakila", rec.Interface())
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	v := reflect.ValueOf(actual)
+	if c := v.FieldByName("City").Interface().(*string); c == nil || *c != "Lethbridge" {
+		t.Errorf("Expected city Lethbridge, Actual: %v", c)
+	}
+	if c := v.FieldByName("Tag").Interface().(*string); c == nil || *c != "b" {
+		t.Errorf("Expected tag b, Actual: %v", c)
+	}
+	if c := v.FieldByName("Visits").Interface().(*int); c == nil || *c != 3 {
+		t.Errorf("Expected visits 3, Actual: %v", c)
+	}
+	if c := v.FieldByName("Vip").Interface().(*bool); c == nil || !*c {
+		t.Errorf("Expected vip true, Actual: %v", c)
+	}
+	if c := v.FieldByName("Balance").Interface().(*decimal.Decimal); c == nil || c.String() != "12.5" {
+		t.Errorf("Expected balance 12.5, Actual: %v", c)
+	}
+	if c := v.FieldByName("Address").Interface().(*stdjson.RawMessage); c == nil || string(*c) != `{"city":"Lethbridge","zip":"T1H"}` {
+		t.Errorf("Expected address object, Actual: %v", c)
+	}
+	if c := v.FieldByName("Missing").Interface().(*string); c != nil {
+		t.Errorf("Expected missing nil, Actual: %v", *c)
+	}
+
+	invalid := stdjson.RawMessage(`{"address":`)
+	rec.FieldByName("Profile").Set(reflect.ValueOf(&invalid))
+	if _, err := a.process("customer", "sakila", rec.Interface()); err == nil {
+		t.Error("Expected error on invalid JSON")
+	}
+
+	for _, c := range []param.Column{
+		{Name: "note", Type: db.String, JSON: &param.JSONOptions{}},
+		{Name: "doc", Type: db.Json, JSON: &param.JSONOptions{Paths: []param.JSONPath{{Path: "$.id", Name: "customer_id"}}}},
+		{Name: "doc", Type: db.Json, JSON: &param.JSONOptions{Paths: []param.JSONPath{{Path: "$.a[x]", Name: "a"}}}},
+	} {
+		p := param.StructRequest{Table: "note", Columns: []param.Column{{Name: "customer_id", Type: db.Int, IsPrimary: true}, c}}
+		if _, err := newRoute(p, generateStruct(p)); err == nil {
+			t.Errorf("Expected error on JSON options of %+v", c)
+		}
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	paths := map[string]jsonPath{
+		"$":                {},
+		"$.a.b":            {"a", "b"},
+		"$.a[0][12]":       {"a", 0, 12},
+		`$."key.with dot"`: {"key.with dot"},
+	}
+	for path, expected := range paths {
+		actual, err := parseJSONPath(path)
+		if err != nil || len(actual) != len(expected) {
+			t.Errorf("%v - Expected: %v, Actual: %v %v", path, expected, actual, err)
+			continue
+		}
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Errorf("%v - Expected: %v, Actual: %v", path, expected, actual)
+			}
+		}
+	}
+	for _, path := range []string{"", "a.b", "$.", "$..a", "$[-1]", "$[1", `$."a`, "$a"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("%q - Expected error", path)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p := param.StructRequest{
+		Table:  "staff",
+		Filter: "active = 1 AND store_id IN (1, 2)",
+		Columns: []param.Column{
+			{Name: "staff_id", Type: db.Int, IsPrimary: true},
+			{Name: "store_id", Type: db.NullableInt},
+			{Name: "active", Type: db.Bool},
+		},
+	}
+	a, rec := newTestAPI(t, p)
+	store := 2
+	rec.FieldByName("Store_id").Set(reflect.ValueOf(&store))
+	if a.Match("staff", rec.Interface()) {
+		t.Error("Expected inactive staff not to match")
+	}
+	rec.FieldByName("Active").SetBool(true)
+	if !a.Match("staff", rec.Interface()) {
+		t.Error("Expected active staff of store 2 to match")
+	}
+	if !a.Match("store", rec.Interface()) {
+		t.Error("Expected rows of a datamodel without filter to match")
+	}
+
+	p.Filter = "store_id = 'A'"
+	if _, err := newRoute(p, generateStruct(p)); err == nil {
+		t.Error("Expected error on invalid filter")
+	}
+}
@@ -0,0 +1,227 @@
+package API
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mysql2mssql/mysql/parser"
+	"mysql2mssql/server/param"
+	"os"
+	"path/filepath"
+
+	"github.com/siddontang/go-log/log"
+)
+
+const (
+	// bucket of the last started Parser & Syncer requests, see `SaveConfig`
+	configBucket = "config"
+	parserKey    = "parser"
+	syncerKey    = "syncer"
+	// file in storage dir holding the generated secret key, see `SetSecretKey`
+	secretKeyFile = "secret.key"
+)
+
+// savedConfig is a start request saved in Log Store, encrypted as a whole since it contains credentials
+type savedConfig struct {
+	Request []byte `json:"request"`
+	// Stopped is true if the Parser/Syncer has been stopped with /parser/stop or /syncer/stop, it's not resumed
+	Stopped bool `json:"stopped"`
+}
+
+// SetSecretKey sets the key encrypting the saved Parser & Syncer requests.
+// The key is derived from `passphrase`, or if it's empty, read from (or generated into) file "secret.key" in storage dir
+func (a *API) SetSecretKey(passphrase string) error {
+	if passphrase != "" {
+		key := sha256.Sum256([]byte(passphrase))
+		a.secretKey = key[:]
+		return nil
+	}
+	if a.DBInterface.Dir() == "" {
+		// in-memory storage, saved requests don't outlive the process anyway
+		a.secretKey = make([]byte, 32)
+		_, err := io.ReadFull(rand.Reader, a.secretKey)
+		return err
+	}
+
+	path := filepath.Join(a.DBInterface.Dir(), secretKeyFile)
+	key, err := ioutil.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return fmt.Errorf("invalid secret key in %v", path)
+		}
+		a.secretKey = key
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	key = make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, key, 0600); err != nil {
+		return err
+	}
+	a.secretKey = key
+	return nil
+}
+
+// ResumeConfigs starts the last started Parser & Syncer again, unless they've been stopped explicitly.
+// The parser continues from its checkpoint (see `resumedParserRequest`), the syncer is resumed even if the parser is not
+func (a *API) ResumeConfigs() error {
+	var p param.StartParserRequest
+	found, err := a.loadConfig(parserKey, &p)
+	if err != nil {
+		return fmt.Errorf("Load parser config error: %v", err)
+	}
+	if found {
+		p = resumedParserRequest(p)
+		log.Infof("resuming parser of %v", p.Addr)
+		if err = recoverError(func() { a.StartParser(p) }); err != nil {
+			return fmt.Errorf("Resume parser error: %v", err)
+		}
+	}
+
+	var s param.StartSyncerRequest
+	if found, err = a.loadConfig(syncerKey, &s); err != nil {
+		return fmt.Errorf("Load syncer config error: %v", err)
+	}
+	if !found {
+		return nil
+	}
+	log.Infof("resuming syncer of %v/%v", s.Server, s.Database)
+	err = recoverError(func() {
+		if a.logStore == nil {
+			// parser stopped, the records it logged are still synced
+			a.openLogStore()
+		}
+		a.StartSyncer(s)
+	})
+	if err != nil {
+		return fmt.Errorf("Resume syncer error: %v", err)
+	}
+	return nil
+}
+
+// resumedParserRequest returns saved request `p` restarting the parser where it stopped: from the checkpoint,
+// without snapshot (the initial load & start position only apply to the /parser/start call)
+func resumedParserRequest(p param.StartParserRequest) param.StartParserRequest {
+	p.Snapshot = false
+	p.StartFrom = string(parser.FromCheckpoint)
+	p.Position.File, p.Position.Pos, p.Position.GTIDSet = "", 0, ""
+	return p
+}
+
+// recoverError runs `f`, returns the value it panicked with as error
+func recoverError(f func()) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	f()
+	return
+}
+
+// saveConfig saves a start request encrypted, it's resumed by `ResumeConfigs`
+func (a *API) saveConfig(key string, request interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("Marshal error: %v", err)
+	}
+	if b, err = a.encrypt(b); err != nil {
+		return err
+	}
+	return a.putConfig(key, savedConfig{Request: b})
+}
+
+// markConfigStopped keeps a saved start request from being resumed
+func (a *API) markConfigStopped(key string) error {
+	c, err := a.getConfig(key)
+	if err != nil || c == nil {
+		return err
+	}
+	c.Stopped = true
+	return a.putConfig(key, *c)
+}
+
+// loadConfig decrypts a saved start request into `request`, returns false if there's none or it has been stopped
+func (a *API) loadConfig(key string, request interface{}) (bool, error) {
+	c, err := a.getConfig(key)
+	if err != nil || c == nil || c.Stopped {
+		return false, err
+	}
+	b, err := a.decrypt(c.Request)
+	if err != nil {
+		return false, err
+	}
+	if err = json.Unmarshal(b, request); err != nil {
+		return false, fmt.Errorf("Unmarshal error: %v", err)
+	}
+	return true, nil
+}
+
+func (a *API) getConfig(key string) (*savedConfig, error) {
+	b, err := a.DBInterface.Get(configBucket, key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	c := &savedConfig{}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("Unmarshal error: %v", err)
+	}
+	return c, nil
+}
+
+func (a *API) putConfig(key string, c savedConfig) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("Marshal error: %v", err)
+	}
+	return a.DBInterface.Put(configBucket, key, b, 0)
+}
+
+// encrypt seals `plain` with AES-GCM, the nonce is prepended to the result
+func (a *API) encrypt(plain []byte) ([]byte, error) {
+	gcm, err := a.gcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func (a *API) decrypt(sealed []byte) ([]byte, error) {
+	gcm, err := a.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted config")
+	}
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Decrypt error, was the secret key changed? %v", err)
+	}
+	return plain, nil
+}
+
+func (a *API) gcm() (cipher.AEAD, error) {
+	if a.secretKey == nil {
+		return nil, errors.New("secret key is not set")
+	}
+	block, err := aes.NewCipher(a.secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,70 @@
+package API
+
+import (
+	"bytes"
+	"mysql2mssql/db"
+	"mysql2mssql/mysql/parser"
+	"mysql2mssql/server/param"
+	"testing"
+)
+
+func TestSavedConfig(t *testing.T) {
+	a := &API{DBInterface: db.UseInmemDB()}
+	if err := a.SetSecretKey("passphrase"); err != nil {
+		t.Fatalf("SetSecretKey failed: %v", err)
+	}
+	expected := param.StartSyncerRequest{Server: "127.0.0.1", Database: "mysql2mssql", Password: "s3cret"}
+	if err := a.saveConfig(syncerKey, expected); err != nil {
+		t.Fatalf("saveConfig failed: %v", err)
+	}
+	if b, _ := a.DBInterface.Get(configBucket, syncerKey); bytes.Contains(b, []byte("s3cret")) {
+		t.Errorf("password is saved in plain text: %s", b)
+	}
+
+	var actual param.StartSyncerRequest
+	if found, err := a.loadConfig(syncerKey, &actual); !found || err != nil || actual != expected {
+		t.Errorf("loadConfig - Expected: %v, Actual: %v %v %v", expected, actual, found, err)
+	}
+
+	other := &API{DBInterface: a.DBInterface}
+	other.SetSecretKey("another passphrase")
+	if _, err := other.loadConfig(syncerKey, &actual); err == nil {
+		t.Errorf("loadConfig - Expected decrypt error with another key")
+	}
+
+	a.markConfigStopped(syncerKey)
+	if found, err := a.loadConfig(syncerKey, &actual); found || err != nil {
+		t.Errorf("loadConfig - Expected stopped config not to be loaded, Actual: %v %v", found, err)
+	}
+}
+
+func TestResumedParserRequest(t *testing.T) {
+	p := param.StartParserRequest{Addr: "127.0.0.1:3306", StartFrom: "from_position", Snapshot: true, PreserveOrder: true}
+	p.Position.File, p.Position.Pos = "mysql-bin.000001", 4
+	actual := resumedParserRequest(p)
+	if actual.Snapshot || actual.StartFrom != "from_checkpoint" || actual.Position.File != "" || actual.Position.Pos != 0 {
+		t.Errorf("Expected parser to resume from checkpoint without snapshot, Actual: %+v", actual)
+	}
+	if actual.Addr != p.Addr || !actual.PreserveOrder {
+		t.Errorf("Expected other options to be kept, Actual: %+v", actual)
+	}
+}
+
+// a saved syncer is resumed even if there's no parser to resume
+func TestResumeSyncerWithoutParser(t *testing.T) {
+	a := &API{DBInterface: db.UseInmemDB(), DataModels: &parser.ModelMap{"staff": &struct {
+		ID int `gorm:"column:id;primaryKey"`
+	}{}}}
+	a.SetSecretKey("passphrase")
+	if err := a.saveConfig(syncerKey, param.StartSyncerRequest{Server: "127.0.0.1", Database: "mysql2mssql", Interval: 3600}); err != nil {
+		t.Fatalf("saveConfig failed: %v", err)
+	}
+	if err := a.ResumeConfigs(); err != nil {
+		t.Fatalf("ResumeConfigs failed: %v", err)
+	}
+	if a.logStore == nil || a.syncer == nil {
+		t.Fatalf("Expected Log Store to be opened & syncer to be resumed")
+	}
+	a.syncer.Stop()
+	a.syncer.Close()
+}
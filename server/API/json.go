@@ -0,0 +1,221 @@
+package API
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"fmt"
+	"mysql2mssql/db"
+	"mysql2mssql/server/param"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// jsonColumn is a JSON column validated or projected into other columns, see param.JSONOptions
+type jsonColumn struct {
+	column   string
+	field    string
+	validate bool
+	paths    []jsonProjection
+}
+
+// jsonProjection is a value extracted from a JSON column into field `field`, see param.JSONPath
+type jsonProjection struct {
+	field string
+	path  jsonPath
+}
+
+// newJSONColumn validates the JSON options of column `c`, `names` are the other column names of the datamodel (lower case)
+func newJSONColumn(c param.Column, names map[string]bool) (*jsonColumn, error) {
+	if c.Type != db.Json && c.Type != db.NullableJson {
+		return nil, fmt.Errorf("column %v has JSON options but is not a JSON column", c.Name)
+	}
+	j := &jsonColumn{column: c.Name, field: strings.Title(c.Name), validate: c.JSON.Validate}
+	for _, p := range c.JSON.Paths {
+		if names[strings.ToLower(p.Name)] {
+			return nil, fmt.Errorf("column %v of JSON path %v is already defined", p.Name, p.Path)
+		}
+		names[strings.ToLower(p.Name)] = true
+		path, err := parseJSONPath(p.Path)
+		if err != nil {
+			return nil, fmt.Errorf("JSON path %v of column %v: %v", p.Path, c.Name, err)
+		}
+		j.paths = append(j.paths, jsonProjection{field: strings.Title(p.Name), path: path})
+	}
+	return j, nil
+}
+
+// apply validates the JSON column of datamodel struct `s` & sets its projected fields
+func (j *jsonColumn) apply(s reflect.Value) error {
+	field := reflect.Indirect(s.FieldByName(j.field))
+	if !field.IsValid() {
+		// NULL, projections are NULL too
+		for _, p := range j.paths {
+			f := s.FieldByName(p.field)
+			f.Set(reflect.Zero(f.Type()))
+		}
+		return nil
+	}
+	var v interface{}
+	dec := stdjson.NewDecoder(bytes.NewReader(field.Bytes()))
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	if err == nil && dec.More() {
+		err = fmt.Errorf("invalid character after top-level value")
+	}
+	if err != nil && j.validate {
+		return fmt.Errorf("column %v is not valid JSON: %v", j.column, err)
+	}
+	for _, p := range j.paths {
+		f := s.FieldByName(p.field)
+		var value interface{}
+		if err == nil {
+			value, _ = p.path.extract(v)
+		}
+		f.Set(convertJSON(value, f.Type()))
+	}
+	return nil
+}
+
+// jsonPath is a parsed MySQL-like JSON path, its legs are object keys (string) or array indexes (int)
+type jsonPath []interface{}
+
+// parseJSONPath parses `path`: "$" followed by ".key", ".\"quoted key\"" or "[index]" legs
+func parseJSONPath(path string) (jsonPath, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("must start with $")
+	}
+	var legs jsonPath
+	for rest := path[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.IndexByte(rest[1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated quoted key")
+				}
+				legs, rest = append(legs, rest[1:end+1]), rest[end+2:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key")
+			}
+			legs, rest = append(legs, rest[:end]), rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated array index")
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid array index %v", rest[1:end])
+			}
+			legs, rest = append(legs, i), rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+	}
+	return legs, nil
+}
+
+// extract returns the value at the path in decoded JSON `v`, false if it is missing
+func (p jsonPath) extract(v interface{}) (interface{}, bool) {
+	for _, leg := range p {
+		switch leg := leg.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[leg]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || leg >= len(arr) {
+				return nil, false
+			}
+			v = arr[leg]
+		}
+	}
+	return v, true
+}
+
+// convertJSON converts decoded JSON value `v` to `t`, a pointer type of a JSONPath column,
+// a nil pointer if `v` is nil or can not be converted
+func convertJSON(v interface{}, t reflect.Type) reflect.Value {
+	null := reflect.Zero(t)
+	if v == nil {
+		return null
+	}
+	var converted interface{}
+	switch t.Elem() {
+	case reflect.TypeOf(""):
+		switch v := v.(type) {
+		case string:
+			converted = v
+		case stdjson.Number:
+			converted = v.String()
+		case bool:
+			converted = strconv.FormatBool(v)
+		default:
+			converted = string(marshalJSON(v))
+		}
+	case reflect.TypeOf(0):
+		if i, err := strconv.ParseInt(jsonScalar(v), 10, 64); err == nil {
+			converted = int(i)
+		}
+	case reflect.TypeOf(false):
+		switch v := v.(type) {
+		case bool:
+			converted = v
+		case stdjson.Number:
+			if f, err := v.Float64(); err == nil {
+				converted = f != 0
+			}
+		}
+	case reflect.TypeOf(float64(0)):
+		if f, err := strconv.ParseFloat(jsonScalar(v), 64); err == nil {
+			converted = f
+		}
+	case reflect.TypeOf(decimal.Decimal{}):
+		if d, err := decimal.NewFromString(jsonScalar(v)); err == nil {
+			converted = d
+		}
+	case reflect.TypeOf(stdjson.RawMessage{}):
+		converted = stdjson.RawMessage(marshalJSON(v))
+	}
+	if converted == nil {
+		return null
+	}
+	p := reflect.New(t.Elem())
+	p.Elem().Set(reflect.ValueOf(converted))
+	return p
+}
+
+// jsonScalar returns the text of a JSON number or string, empty for other values
+func jsonScalar(v interface{}) string {
+	switch v := v.(type) {
+	case stdjson.Number:
+		return v.String()
+	case string:
+		return v
+	}
+	return ""
+}
+
+// marshalJSON encodes decoded JSON value `v` the same way as the parser canonicalizes JSON columns
+func marshalJSON(v interface{}) []byte {
+	buf := &bytes.Buffer{}
+	enc := stdjson.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
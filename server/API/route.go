@@ -0,0 +1,196 @@
+package API
+
+import (
+	"fmt"
+	"mysql2mssql/db"
+	"mysql2mssql/filter"
+	"mysql2mssql/server/param"
+	"mysql2mssql/transform"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// route decides which source schemas & rows a datamodel is parsed from, the discriminator injected into its rows,
+// the transformations of its columns & the validation/projections of its JSON columns, see param.StructRequest
+type route struct {
+	schemaRegex   *regexp.Regexp
+	filter        *filter.Filter
+	discriminator *param.Discriminator
+	transforms    []fieldTransform
+	jsonColumns   []*jsonColumn
+}
+
+// fieldTransform is a transformation of a datamodel field, see param.Column.Transforms
+type fieldTransform struct {
+	column      string
+	field       string
+	name        string
+	transformer transform.Transformer
+}
+
+// newRoute creates the route of table structure `p`, `strct` is its datamodel (see `generateStruct`)
+func newRoute(p param.StructRequest, strct interface{}) (*route, error) {
+	pattern := ".*"
+	if p.SchemaRegex != "" {
+		if strings.Contains(p.Table, ".") {
+			return nil, fmt.Errorf("schema_regex can not be used with schema-qualified table %v", p.Table)
+		}
+		pattern = p.SchemaRegex
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(p.Columns)+1)
+	for _, c := range p.Columns {
+		names[strings.ToLower(c.Name)] = true
+	}
+	if d := p.Discriminator; d != nil {
+		if names[strings.ToLower(d.Name)] {
+			return nil, fmt.Errorf("discriminator %v is also a column of %v", d.Name, p.Table)
+		}
+		names[strings.ToLower(d.Name)] = true
+	}
+	r := &route{schemaRegex: re, discriminator: p.Discriminator}
+	for _, c := range p.Columns {
+		if c.JSON != nil {
+			j, err := newJSONColumn(c, names)
+			if err != nil {
+				return nil, err
+			}
+			r.jsonColumns = append(r.jsonColumns, j)
+		}
+	}
+	if p.Filter != "" {
+		if r.filter, err = filter.New(p.Filter, strct); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range p.Columns {
+		for _, t := range c.Transforms {
+			transformer, err := transform.New(t.Name, t.Options)
+			if err != nil {
+				return nil, fmt.Errorf("transformation %v of column %v: %v", t.Name, c.Name, err)
+			}
+			r.transforms = append(r.transforms, fieldTransform{
+				column:      c.Name,
+				field:       strings.Title(c.Name),
+				name:        t.Name,
+				transformer: transformer,
+			})
+		}
+	}
+	return r, nil
+}
+
+// discriminatorValue expands the discriminator value from source schema `schemaName`
+func (r *route) discriminatorValue(schemaName string) (interface{}, error) {
+	template := r.discriminator.Value
+	if template == "" {
+		template = "$0"
+	}
+	var b []byte
+	for _, match := range r.schemaRegex.FindAllStringSubmatchIndex(schemaName, 1) {
+		b = r.schemaRegex.ExpandString(b, template, schemaName, match)
+	}
+	value := string(b)
+	switch r.discriminator.Type {
+	case db.Int:
+		return strconv.Atoi(value)
+	case db.UInt:
+		u, err := strconv.ParseUint(value, 10, 64)
+		return uint(u), err
+	default:
+		return value, nil
+	}
+}
+
+func (a *API) setRoute(tabName string, r *route) {
+	a.routesMu.Lock()
+	defer a.routesMu.Unlock()
+	if a.routes == nil {
+		a.routes = make(map[string]*route)
+	}
+	a.routes[tabName] = r
+}
+
+func (a *API) route(tabName string) *route {
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+	return a.routes[tabName]
+}
+
+// ModelKey implements parser.ModelResolverInterface, a schema-qualified datamodel takes precedence,
+// an unqualified one must match the source schema with its SchemaRegex
+func (a *API) ModelKey(schemaName string, tableName string) string {
+	// datamodels may be replaced while parsing, read them through Log Store
+	if key := schemaName + "." + tableName; a.logStore.Model(key) != nil {
+		return key
+	}
+	if a.logStore.Model(tableName) == nil {
+		return ""
+	}
+	if r := a.route(tableName); r != nil && !r.schemaRegex.MatchString(schemaName) {
+		return ""
+	}
+	return tableName
+}
+
+// Match implements parser.RowFilterInterface
+func (a *API) Match(model string, rec interface{}) bool {
+	r := a.route(model)
+	return r == nil || r.filter == nil || r.filter.Match(rec)
+}
+
+// process returns a copy of `rec` (parsed into datamodel `key` from source schema `schemaName`)
+// with its discriminator set, its columns transformed & its JSON columns validated & projected,
+// `rec` itself if the datamodel has none of them
+func (a *API) process(key string, schemaName string, rec interface{}) (interface{}, error) {
+	r := a.route(key)
+	if r == nil || (r.discriminator == nil && len(r.transforms) == 0 && len(r.jsonColumns) == 0) || rec == nil {
+		return rec, nil
+	}
+	v := reflect.New(reflect.TypeOf(rec)).Elem()
+	v.Set(reflect.ValueOf(rec))
+	s := reflect.Indirect(v)
+
+	if r.discriminator != nil {
+		value, err := r.discriminatorValue(schemaName)
+		if err != nil {
+			return nil, fmt.Errorf("discriminator %v of schema %v: %v", r.discriminator.Name, schemaName, err)
+		}
+		field := s.FieldByName(strings.Title(r.discriminator.Name))
+		if !field.IsValid() {
+			return nil, fmt.Errorf("discriminator %v is not defined in datamodel of %v", r.discriminator.Name, key)
+		}
+		field.Set(reflect.ValueOf(value))
+	}
+
+	for _, t := range r.transforms {
+		field := s.FieldByName(t.field)
+		if !field.IsValid() {
+			return nil, fmt.Errorf("column %v is not defined in datamodel of %v", t.column, key)
+		}
+		value, err := t.transformer.Transform(field.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("transformation %v of column %v: %v", t.name, t.column, err)
+		}
+		if value == nil {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		if tv := reflect.TypeOf(value); tv != field.Type() {
+			return nil, fmt.Errorf("transformation %v of column %v returned %v, expected %v", t.name, t.column, tv, field.Type())
+		}
+		field.Set(reflect.ValueOf(value))
+	}
+
+	for _, j := range r.jsonColumns {
+		if err := j.apply(s); err != nil {
+			return nil, err
+		}
+	}
+	return v.Interface(), nil
+}
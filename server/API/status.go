@@ -0,0 +1,87 @@
+package API
+
+import (
+	"fmt"
+	"mysql2mssql/mysql/parser"
+	"mysql2mssql/syncer"
+	"time"
+)
+
+// Status of Parser, Syncer & Log Store, see `API.Status`
+type Status struct {
+	// Healthy is true when both Parser & Syncer are running
+	Healthy bool          `json:"healthy"`
+	Parser  ParserStatus  `json:"parser"`
+	Syncer  syncer.Status `json:"syncer"`
+	// JournalPending is the number of records waiting to be synced in source commit order (see param.StartParserRequest)
+	JournalPending int                           `json:"journal_pending,omitempty"`
+	Tables         map[string]syncer.TableStatus `json:"tables,omitempty"`
+}
+
+// ParserStatus is the state of the binlog listener
+type ParserStatus struct {
+	// State is one of "running", "stopped" or "failed"
+	State   parser.State `json:"state"`
+	File    string       `json:"file,omitempty"`
+	Pos     uint32       `json:"pos,omitempty"`
+	GTIDSet string       `json:"gtid_set,omitempty"`
+	// Lag is the replication delay behind master, in seconds
+	Lag           uint32     `json:"lag"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// Status returns the state of Parser & Syncer, along with the pending records of every table
+func (a *API) Status() (status Status, err error) {
+	status.Parser = a.parserStatus()
+	if a.syncer != nil {
+		status.Syncer = a.syncer.Status()
+	}
+	status.Healthy = status.Parser.State == parser.Running && status.Syncer.Running
+	if a.logStore == nil {
+		return
+	}
+
+	if a.logStore.Ordered {
+		// nutsdb returns an error on missing list
+		status.JournalPending, _ = a.logStore.JournalSize()
+	}
+	status.Tables = map[string]syncer.TableStatus{}
+	for _, table := range a.logStore.Tables() {
+		if status.Tables[table], err = a.logStore.TableStatus(table); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// TableStatus returns the pending records, dead letters & pause reason of a table
+func (a *API) TableStatus(tabName string) (*syncer.TableStatus, error) {
+	if a.logStore == nil {
+		return nil, errLogStoreNotInitialized
+	}
+	if a.logStore.Model(tabName) == nil {
+		return nil, fmt.Errorf("table structure %v is not defined", tabName)
+	}
+	status, err := a.logStore.TableStatus(tabName)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (a *API) parserStatus() ParserStatus {
+	if a.eventWrapper == nil {
+		return ParserStatus{State: parser.Stopped}
+	}
+	s := a.eventWrapper.Status()
+	return ParserStatus{
+		State:         s.State,
+		File:          s.Position.Name,
+		Pos:           s.Position.Pos,
+		GTIDSet:       s.Position.GTIDSet,
+		Lag:           s.Delay,
+		LastError:     s.LastError,
+		LastErrorTime: s.LastErrorTime,
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Role of an authenticated client
+type Role int
+
+const (
+	// ReadOnly can call the GET endpoints, such as /struct/get, /status & /metrics
+	ReadOnly Role = iota + 1
+	// Admin can call all endpoints
+	Admin
+)
+
+// ParseRole converts "read" or "admin" to Role
+func ParseRole(s string) (Role, error) {
+	switch s {
+	case "read":
+		return ReadOnly, nil
+	case "admin":
+		return Admin, nil
+	}
+	return 0, fmt.Errorf("unknown role %q, must be \"read\" or \"admin\"", s)
+}
+
+// Authenticator identifies the client of a request, see Options.Auth
+type Authenticator interface {
+	// Authenticate returns the role of the client, 0 if the request carries no credentials it recognizes
+	Authenticate(r *http.Request) Role
+}
+
+// TokenAuth authenticates requests by static tokens (API keys) mapped to their role,
+// sent as header "Authorization: Bearer <token>" or "X-API-Key: <token>"
+type TokenAuth map[string]Role
+
+// Authenticate implements Authenticator
+func (a TokenAuth) Authenticate(r *http.Request) (role Role) {
+	token := r.Header.Get("X-API-Key")
+	if h := r.Header.Get(echo.HeaderAuthorization); token == "" && strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	}
+	if token == "" {
+		return 0
+	}
+	// compare with every token in constant time, not to leak which one is close
+	for t, r := range a {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			role = r
+		}
+	}
+	return
+}
+
+// ClientCertAuth authenticates requests by the common name of their verified TLS client certificate (mTLS),
+// only applies when the server is listening with TLS & verifying client certificates
+type ClientCertAuth map[string]Role
+
+// Authenticate implements Authenticator
+func (a ClientCertAuth) Authenticate(r *http.Request) Role {
+	// certificates are only set in VerifiedChains if they're verified against the client CAs
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return 0
+	}
+	return a[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+}
+
+// authMiddleware rejects the requests whose client is not authenticated by any of `auths`,
+// GET requests require ReadOnly role, others require Admin
+func authMiddleware(auths []Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var role Role
+			for _, a := range auths {
+				if role = a.Authenticate(c.Request()); role != 0 {
+					break
+				}
+			}
+			if role == 0 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or invalid credentials")
+			}
+			if requiredRole(c.Request().Method) > role {
+				return echo.NewHTTPError(http.StatusForbidden, "admin role is required")
+			}
+			return next(c)
+		}
+	}
+}
+
+func requiredRole(method string) Role {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ReadOnly
+	}
+	return Admin
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(authMiddleware([]Authenticator{TokenAuth{"monitor-token": ReadOnly, "admin-token": Admin}}))
+	ok := func(c echo.Context) error { return c.String(http.StatusOK, "OK") }
+	e.GET("/status", ok)
+	e.POST("/parser/start", ok)
+
+	cases := []struct {
+		method string
+		path   string
+		header string
+		value  string
+		code   int
+	}{
+		{http.MethodGet, "/status", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/status", echo.HeaderAuthorization, "Bearer wrong-token", http.StatusUnauthorized},
+		{http.MethodGet, "/status", echo.HeaderAuthorization, "Bearer monitor-token", http.StatusOK},
+		{http.MethodGet, "/status", "X-API-Key", "admin-token", http.StatusOK},
+		{http.MethodPost, "/parser/start", echo.HeaderAuthorization, "Bearer monitor-token", http.StatusForbidden},
+		{http.MethodPost, "/parser/start", "X-API-Key", "admin-token", http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, c.code, rec.Code, "%v %v with %v: %v", c.method, c.path, c.header, c.value)
+	}
+}
@@ -27,8 +27,9 @@ type handler struct {
 	validator *customValidator
 }
 
-// create new handler for the Server that manages storage type, data models & request validations
-func newHandler(dbType string, dbConfig *db.Options) *handler {
+// create new handler for the Server that manages storage type, data models & request validations,
+// `secretKey` encrypts the saved Parser & Syncer requests (see API.SetSecretKey)
+func newHandler(dbType string, dbConfig *db.Options, secretKey string) *handler {
 	var dbEngine db.Interface
 	if dbType == "nutsdb" || dbType == "" {
 		dbEngine = db.UseNutsDB(*dbConfig)
@@ -46,6 +47,9 @@ func newHandler(dbType string, dbConfig *db.Options) *handler {
 	if err := h.LoadDataModels(); err != nil {
 		panic(err)
 	}
+	if err := h.SetSecretKey(secretKey); err != nil {
+		panic(err)
+	}
 	return h
 }
 
@@ -72,6 +76,39 @@ func (h *handler) getStruct(c echo.Context) (err error) {
 	return c.JSON(http.StatusOK, h.Get(tabName))
 }
 
+func (h *handler) getDDL(c echo.Context) (err error) {
+	ddl, err := h.DDL(c.Param("name"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.String(http.StatusOK, ddl)
+}
+
+func (h *handler) discoverStruct(c echo.Context) (err error) {
+	defer func() {
+		e := recover()
+		if e != nil {
+			err = echo.NewHTTPError(http.StatusInternalServerError, e)
+		}
+	}()
+
+	p := &param.DiscoverStructRequest{}
+	if err = c.Bind(p); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bind: "+err.Error())
+	}
+	if err = c.Validate(p); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "validate: "+err.Error())
+	}
+	structs, err := h.Discover(*p)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if p.Save {
+		return c.JSON(http.StatusCreated, structs)
+	}
+	return c.JSON(http.StatusOK, structs)
+}
+
 func (h *handler) startParser(c echo.Context) (err error) {
 	defer func() {
 		e := recover()
@@ -93,6 +130,14 @@ func (h *handler) startParser(c echo.Context) (err error) {
 	return c.String(http.StatusAccepted, "OK")
 }
 
+func (h *handler) getSchemaChanges(c echo.Context) (err error) {
+	changes, err := h.SchemaChanges()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.JSON(http.StatusOK, changes)
+}
+
 func (h *handler) stopParser(c echo.Context) (err error) {
 	if err = h.StopParser(); err != nil {
 		return echo.NewHTTPError(http.StatusConflict, "Parser is closed, or has not been started")
@@ -140,6 +185,74 @@ func (h *handler) startSyncer(c echo.Context) (err error) {
 	return c.String(http.StatusAccepted, "OK")
 }
 
+func (h *handler) getDeadLetters(c echo.Context) (err error) {
+	list, err := h.DeadLetters(c.Param("table"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+func (h *handler) getDeadLetter(c echo.Context) (err error) {
+	d, err := h.DeadLetter(c.Param("table"), c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if d == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "dead letter not found")
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+func (h *handler) editDeadLetter(c echo.Context) (err error) {
+	p := &param.DeadLetterRequest{}
+	if err = c.Bind(p); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "bind: "+err.Error())
+	}
+	d, err := h.EditDeadLetter(c.Param("table"), c.Param("id"), *p)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if d == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "dead letter not found")
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+func (h *handler) retryDeadLetter(c echo.Context) (err error) {
+	if err = h.RetryDeadLetter(c.Param("table"), c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.String(http.StatusOK, "OK")
+}
+
+func (h *handler) discardDeadLetter(c echo.Context) (err error) {
+	if err = h.DiscardDeadLetter(c.Param("table"), c.Param("id")); err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.String(http.StatusOK, "OK")
+}
+
+// responds 503 if Parser or Syncer is not running, for load balancer health checks
+func (h *handler) getStatus(c echo.Context) (err error) {
+	status, err := h.Status()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if !status.Healthy {
+		return c.JSON(http.StatusServiceUnavailable, status)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+func (h *handler) getTableStatus(c echo.Context) (err error) {
+	status, err := h.TableStatus(c.Param("table"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
 func (h *handler) stopSyncer(c echo.Context) (err error) {
 	if err = h.StopSyncer(); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
@@ -59,6 +59,21 @@ var (
 			"client_key": "%s"
 		}
 	}`, rootPem, clientCert, clientKey)
+	discoverJSON = fmt.Sprintf(`{
+		"addr": "35.240.181.214:3306",
+		"user": "root",
+		"password": "root",
+		"schema": "sakila",
+		"table_regex": "staff",
+		"exclude_columns": ["picture"],
+		"save": true,
+		"tls_config": {
+			"server_name": "mysql-to-mssql-syncer:a1",
+			"server_ca": "%s",
+			"client_cert": "%s",
+			"client_key": "%s"
+		}
+	}`, rootPem, clientCert, clientKey)
 	storeConfigJSON = `{
 		"server": "127.0.0.1",
 		"database": "mysql2mssql",
@@ -78,7 +93,7 @@ func setUp(json string) (c echo.Context, h *handler, rec *httptest.ResponseRecor
 
 	rec = httptest.NewRecorder()
 	c = e.NewContext(req, rec)
-	h = newHandler("inmem", nil)
+	h = newHandler("inmem", nil, "")
 	e.Validator = h.validator
 
 	return
@@ -114,6 +129,16 @@ func TestGetStruct(t *testing.T) {
 	}
 }
 
+func TestDiscoverStruct(t *testing.T) {
+	c, h, rec := setUp(discoverJSON)
+
+	if assert.NoError(t, h.discoverStruct(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, 1, len(*h.DataModels))
+		assert.NotNil(t, (*h.DataModels)["staff"])
+	}
+}
+
 func TestStartBinlog(t *testing.T) {
 	c, h, _ := setUp(requestJSON)
 	h.putStruct(c)
@@ -1,18 +1,134 @@
 package param
 
-import "mysql2mssql/db"
+import (
+	"encoding/json"
+	"mysql2mssql/db"
+)
 
 type (
 	// StructRequest is the request to add/edit "Datamodels", which represent the table structure in source / target DBs
+	//
+	// Table: "schema.table", or "table" to match the table of that name in every schema (unless it has its own "schema.table" datamodel)
+	//
+	// TargetSchema: schema of the table in target db (Default: the schema of Table if qualified,
+	// otherwise the default schema of the login, usually "dbo")
+	//
+	// TargetTable: name of the table in target db (Default: same as Table)
+	//
+	// SchemaRegex: only tables of the schemas fully matching it are parsed into this datamodel, Table must not be schema-qualified.
+	// Used with Discriminator to merge the same table of many schemas into one target table
+	//
+	// Discriminator: a column injected into every row & added to the primary key, see Discriminator
+	//
+	// Filter: only the rows matching this SQL-like predicate on the columns are synced, see filter.New for the syntax.
+	// Example: "active = 1 AND store_id IN (1, 2)". An update moving a row into the filter is synced as an insert,
+	// out of the filter as a delete. Changing it does not sync the rows which were not changed since, use a snapshot for that
 	StructRequest struct {
-		Table   string   `json:"table" validate:"required"`
-		Columns []Column `json:"columns" validate:"required,dive"`
+		Table         string         `json:"table" validate:"required"`
+		Columns       []Column       `json:"columns" validate:"required,dive"`
+		TargetSchema  string         `json:"target_schema,omitempty"`
+		TargetTable   string         `json:"target_table,omitempty"`
+		SchemaRegex   string         `json:"schema_regex,omitempty"`
+		Discriminator *Discriminator `json:"discriminator,omitempty"`
+		Filter        string         `json:"filter,omitempty"`
 	}
-	// Column metadata for a column in a table
+	// Discriminator is a column which does not exist in source table, its value is injected into every row
+	// & it is part of the primary key, to tell apart the rows of different source schemas in the target table
+	//
+	// Type: Int, UInt or String (Default: String)
+	//
+	// Value: a constant, or a template expanded from the source schema name: "$0" is the whole name,
+	// "$1" or "${name}" the capture groups of SchemaRegex (Default: "$0").
+	// Example: with SchemaRegex "tenant_(\\d+)", Value "$1" & Type Int, rows of schema "tenant_42" get 42
+	Discriminator struct {
+		Name       string       `json:"name" validate:"required"`
+		Type       db.MySQLType `json:"type,omitempty" validate:"omitempty,oneof=1 3 5"`
+		Value      string       `json:"value,omitempty"`
+		TargetName string       `json:"target_name,omitempty"`
+	}
+	// Column metadata for a column in a table, TargetName is the name of the column in target db (Default: same as Name)
+	//
+	// Transforms: transformations applied in order to the value of the column before it's logged, see Transform
+	//
+	// JSON: options of a Json or NullableJson column, see JSONOptions
 	Column struct {
-		Name      string       `json:"name" validate:"required"`
-		Type      db.MySQLType `json:"type" validate:"required,numeric,lte=20"`
-		IsPrimary bool         `json:"is_primary,omitempty"`
+		Name       string       `json:"name" validate:"required"`
+		Type       db.MySQLType `json:"type" validate:"required,numeric,lte=40"`
+		IsPrimary  bool         `json:"is_primary,omitempty"`
+		TargetName string       `json:"target_name,omitempty"`
+		Transforms []Transform  `json:"transforms,omitempty" validate:"omitempty,dive"`
+		JSON       *JSONOptions `json:"json,omitempty"`
+	}
+	// JSONOptions of a JSON column
+	//
+	// Validate: when set to true, rows whose value is not valid JSON (e.g. in a text column) are not synced (an error is logged),
+	// otherwise invalid JSON text is synced as is
+	//
+	// Paths: values extracted from the JSON into columns of their own, see JSONPath
+	JSONOptions struct {
+		Validate bool       `json:"validate,omitempty"`
+		Paths    []JSONPath `json:"paths,omitempty" validate:"omitempty,dive"`
+	}
+	// JSONPath is a value extracted from a JSON column into a column which does not exist in source table
+	//
+	// Path: "$" followed by ".key", ".\"quoted key\"" or "[index]" legs, example: "$.address.city", "$.tags[0]"
+	//
+	// Name: name of the column, TargetName as in Column
+	//
+	// Type: NullableInt, NullableString, NullableBool, NullableDouble, NullableDecimal or NullableJson (Default: NullableString).
+	// The column is NULL if the value is missing, a JSON null, or can not be converted to Type
+	JSONPath struct {
+		Path       string       `json:"path" validate:"required"`
+		Name       string       `json:"name" validate:"required"`
+		Type       db.MySQLType `json:"type,omitempty" validate:"omitempty,oneof=2 6 8 14 16 28"`
+		TargetName string       `json:"target_name,omitempty"`
+	}
+	// Transform is a value transformation of a column, Name is either a built-in one or one added with transform.Register
+	// 	* "trim", "lower", "upper" - String columns
+	// 	* "mask_email" - String columns, keeps the first character & the domain, "john@mail.com" => "j***@mail.com"
+	// 	* "hash" - String columns, hex encoded SHA-256 of the value, Options: {"salt": "..."}
+	// 	* "map" - String columns, replaces the values found in Options (e.g. {"active": "A", "inactive": "I"}), others are left as is
+	// 	* "zero_date_to_null" - NullableDateTime columns, MySQL zero dates ("0000-00-00") become NULL
+	Transform struct {
+		Name    string            `json:"name" validate:"required"`
+		Options map[string]string `json:"options,omitempty"`
+	}
+	// DiscoverStructRequest is the request to generate "Datamodels" from the table definitions
+	// in source db's information_schema, instead of defining them column by column with StructRequest
+	//
+	// Schema: the database containing the tables
+	//
+	// TableRegex: only tables whose name fully matches it are discovered (Default: all tables in Schema)
+	//
+	// ExcludeColumns: columns to leave out of the datamodels, either "column" (all tables) or "table.column"
+	//
+	// UseDecimal: map decimal columns to Decimal instead of Double, should be the same as in StartParserRequest
+	//
+	// Qualified: key the datamodels by "schema.table" instead of "table", so that they only match tables of Schema
+	//
+	// Save: when set to true, discovered datamodels are saved like with StructRequest, otherwise they're only returned
+	DiscoverStructRequest struct {
+		Addr      string `json:"addr" validate:"required,hostname_port"`
+		User      string `json:"user" validate:"required,alphanum"`
+		Password  string `json:"password" validate:"required,alphanum"`
+		TLSConfig struct {
+			ServerName string `json:"server_name,omitempty"`
+			ServerCA   string `json:"server_ca,omitempty"`
+			ClientCert string `json:"client_cert,omitempty"`
+			ClientKey  string `json:"client_key,omitempty"`
+		} `json:"tls_config,omitempty"`
+		Schema         string   `json:"schema" validate:"required"`
+		TableRegex     string   `json:"table_regex,omitempty"`
+		ExcludeColumns []string `json:"exclude_columns,omitempty"`
+		UseDecimal     bool     `json:"use_decimal,omitempty"`
+		Qualified      bool     `json:"qualified,omitempty"`
+		Save           bool     `json:"save,omitempty"`
+	}
+	// DeadLetterRequest is the request to edit a dead-lettered record before retrying it,
+	// Old & New are the JSON of the datamodel (keyed by field names), omit one to keep it unchanged
+	DeadLetterRequest struct {
+		Old json.RawMessage `json:"old,omitempty"`
+		New json.RawMessage `json:"new,omitempty"`
 	}
 	// StartParserRequest is the request for starting the sourceDB Parser
 	// & log changes to an embedded Log Store (defaults to "nutsdb")
@@ -24,6 +140,23 @@ type (
 	// This will include all database's 'canal' table, except database 'mysql'
 	//
 	// UseDecimal: When set to true, go-mysql will use Decimal package for decimal types
+	//
+	// StartFrom: where to start reading the binlog
+	// 	* "from_checkpoint" - resume from the last logged position saved in Log Store, or from now if there's none (Default)
+	// 	* "from_now" - start from current master position, changes made while the parser was down are skipped
+	// 	* "from_position" - start from `Position`
+	//
+	// Snapshot: when set to true, current rows of all datamodels are read & logged as inserts first,
+	// then the parser continues from the binlog position at snapshot time (StartFrom is ignored)
+	//
+	// PreserveOrder: when set to true, changes of all tables are logged into one global journal with source transaction boundaries,
+	// the syncer then applies them in source commit order, one target transaction per source transaction
+	//
+	// SchemaChangePolicy: what to do when a DDL event on source db makes a datamodel stale
+	// 	* "pause" - stop syncing the table until its datamodel is updated with /struct/put, changes are still logged (Default)
+	// 	* "extend" - add new columns to the datamodel & remove dropped ones
+	// 	* "propagate" - same as "extend", the target table is also altered before its next sync
+	// a dropped/renamed table or a change of primary key always pauses the table
 	StartParserRequest struct {
 		ServerID          uint32   `json:"server_id" validate:"required,numeric"`
 		Addr              string   `json:"addr" validate:"required,hostname_port"`
@@ -39,6 +172,15 @@ type (
 			ClientCert string `json:"client_cert,omitempty"`
 			ClientKey  string `json:"client_key,omitempty"`
 		} `json:"tls_config,omitempty"`
+		StartFrom string `json:"start_from,omitempty" validate:"omitempty,oneof=from_checkpoint from_now from_position"`
+		Position  struct {
+			File    string `json:"file,omitempty"`
+			Pos     uint32 `json:"pos,omitempty"`
+			GTIDSet string `json:"gtid_set,omitempty"`
+		} `json:"position,omitempty"`
+		Snapshot           bool   `json:"snapshot,omitempty"`
+		PreserveOrder      bool   `json:"preserve_order,omitempty"`
+		SchemaChangePolicy string `json:"schema_change_policy,omitempty" validate:"omitempty,oneof=pause extend propagate"`
 	}
 	// StartSyncerRequest for starting targetDB Syncer, there'll be a scheduled job to scan Log Store
 	// for unsynced changes and perform changes immediately
@@ -64,14 +206,36 @@ type (
 	// 	* "true" - Data sent between client and server is encrypted.
 	//
 	// Appname: the programe_name in dm_exec_sessions (default is go-mssqldb)
+	//
+	// BatchSize: max number of records per table applied in one MSSQL transaction during each sync pass (default 1000)
+	//
+	// ApplyMode:
+	// 	* "plain" - inserts are written with `insert into`, replaying a record may cause primary key violation (Default)
+	// 	* "upsert" - inserts & updates are written with `merge` keyed on primary key columns, so replays are always safe
+	//
+	// CreateTables: when set to true, target tables that do not exist yet are created from the datamodels (see /struct/ddl/:name)
+	//
+	// MaxRetries: max number of retries of a sync pass failed on transient errors, such as deadlocks or connection loss (default 5, -1 to disable)
+	//
+	// RetryIntervalMs, MaxRetryIntervalMs: wait before first retry, doubled on each retry up to MaxRetryIntervalMs (default 1000 & 60000)
+	//
+	// RetryJitter: randomizes each wait by up to ±RetryJitter of it, between 0 & 1 (default 0.2, -1 to disable)
 	StartSyncerRequest struct {
-		Interval int64  `json:"interval,omitempty" validate:"numeric"`
-		Server   string `json:"server" validate:"required,ip"`
-		Database string `json:"database" validate:"required"`
-		Userid   string `json:"user_id,omitempty"`
-		Password string `json:"password,omitempty"`
-		Log      uint8  `json:"log,omitempty" validate:"numeric"`
-		Encrypt  string `json:"encrypt,omitempty"`
-		Appname  string `json:"app_name,omitempty"`
+		Interval     int64  `json:"interval,omitempty" validate:"numeric"`
+		Server       string `json:"server" validate:"required,ip"`
+		Database     string `json:"database" validate:"required"`
+		Userid       string `json:"user_id,omitempty"`
+		Password     string `json:"password,omitempty"`
+		Log          uint8  `json:"log,omitempty" validate:"numeric"`
+		Encrypt      string `json:"encrypt,omitempty"`
+		Appname      string `json:"app_name,omitempty"`
+		BatchSize    int    `json:"batch_size,omitempty" validate:"omitempty,min=1"`
+		ApplyMode    string `json:"apply_mode,omitempty" validate:"omitempty,oneof=plain upsert"`
+		CreateTables bool   `json:"create_tables,omitempty"`
+
+		MaxRetries         int     `json:"max_retries,omitempty"`
+		RetryIntervalMs    int64   `json:"retry_interval_ms,omitempty" validate:"omitempty,min=0"`
+		MaxRetryIntervalMs int64   `json:"max_retry_interval_ms,omitempty" validate:"omitempty,min=0"`
+		RetryJitter        float64 `json:"retry_jitter,omitempty" validate:"omitempty,max=1"`
 	}
 )
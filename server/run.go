@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"mysql2mssql/config"
+	"mysql2mssql/db"
+)
+
+// Run starts the pipeline defined in `cfg` (see package config), then listens for requests on `cfg.Listen`
+func Run(cfg config.Config) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+
+	auth, err := authenticators(cfg.Auth)
+	if err != nil {
+		return err
+	}
+	s := NewServer(db.Options{
+		Dir:         cfg.Store.Dir,
+		SegmentSize: cfg.Store.SegmentSize,
+	}, Options{
+		// pipeline defined in file takes precedence over the saved one
+		AutoResume: cfg.AutoResume && cfg.Parser == nil,
+		SecretKey:  cfg.SecretKey,
+		Backend:    cfg.Store.Backend,
+		Auth:       auth,
+		TLS:        tlsOptions(cfg.TLS),
+	})
+
+	if cfg.Discover != nil {
+		cfg.Discover.Save = true
+		if _, err = s.Discover(*cfg.Discover); err != nil {
+			return fmt.Errorf("discover: %v", err)
+		}
+	}
+	for _, model := range cfg.Datamodels {
+		if _, err = s.Put(model); err != nil {
+			return fmt.Errorf("datamodel %v: %v", model.Table, err)
+		}
+	}
+	if cfg.Parser != nil {
+		s.StartParser(*cfg.Parser)
+	}
+	if cfg.Syncer != nil {
+		s.StartSyncer(*cfg.Syncer)
+	}
+
+	s.StartServer(cfg.Listen)
+	return nil
+}
+
+// authenticators converts the auth section of config
+func authenticators(cfg config.Auth) (auths []Authenticator, err error) {
+	if len(cfg.Tokens) > 0 {
+		tokens := TokenAuth{}
+		for _, t := range cfg.Tokens {
+			if tokens[t.Token], err = ParseRole(t.Role); err != nil {
+				return nil, err
+			}
+		}
+		auths = append(auths, tokens)
+	}
+	if len(cfg.ClientCerts) > 0 {
+		certs := ClientCertAuth{}
+		for _, c := range cfg.ClientCerts {
+			if certs[c.CommonName], err = ParseRole(c.Role); err != nil {
+				return nil, err
+			}
+		}
+		auths = append(auths, certs)
+	}
+	return
+}
+
+func tlsOptions(cfg *config.TLS) *TLSOptions {
+	if cfg == nil {
+		return nil
+	}
+	return &TLSOptions{
+		CertFile:          cfg.CertFile,
+		KeyFile:           cfg.KeyFile,
+		ClientCAFile:      cfg.ClientCAFile,
+		RequireClientCert: cfg.RequireClientCert,
+	}
+}
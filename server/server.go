@@ -6,19 +6,49 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/siddontang/go-log/log"
 )
 
 // Server can be embedded and used in a desktop application
 type Server struct {
 	*handler
+	auth []Authenticator
+	tls  *TLSOptions
+}
+
+// Options of Server
+type Options struct {
+	// AutoResume restarts the last started Parser & Syncer (unless stopped with /parser/stop or /syncer/stop)
+	AutoResume bool
+	// SecretKey is the passphrase encrypting the saved Parser & Syncer requests, which contain credentials.
+	// If empty, a random key is generated & kept in file "secret.key" of the storage dir
+	SecretKey string
+	// Backend is the Log Store storage, "nutsdb" (Default) or "inmem"
+	Backend string
+	// Auth authenticates the clients of the HTTP API, tried in order until one recognizes the credentials.
+	// If empty, the API is open to anyone who can reach it
+	Auth []Authenticator
+	// TLS serves the HTTP API over HTTPS (and /parser/stream over WSS), plain HTTP if nil
+	TLS *TLSOptions
 }
 
 // NewServer creates new instance of Server, default Log Store storage is "nutsdb"
-func NewServer(dbConfig db.Options) *Server {
-	return &Server{newHandler("nutsdb", &dbConfig)}
+func NewServer(dbConfig db.Options, opts Options) *Server {
+	s := &Server{
+		handler: newHandler(opts.Backend, &dbConfig, opts.SecretKey),
+		auth:    opts.Auth,
+		tls:     opts.TLS,
+	}
+	if opts.AutoResume {
+		if err := s.ResumeConfigs(); err != nil {
+			log.Errorf("Auto resume error: %v", err)
+		}
+	}
+	return s
 }
 
-// StartServer starts listening for request, default address localhost:1323
+// StartServer starts listening for request, default address localhost:1323 (HTTPS if Options.TLS is set)
 func (s *Server) StartServer(address string) {
 	if address == "" {
 		address = ":1323"
@@ -28,21 +58,52 @@ func (s *Server) StartServer(address string) {
 	e.Validator = s.handler.validator
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	if len(s.auth) > 0 {
+		e.Use(authMiddleware(s.auth))
+	} else {
+		log.Warnf("no authentication configured, the API is open to anyone who can reach %v", address)
+	}
 
 	// add/edit datamodels
 	structGroup := e.Group("/struct")
 	structGroup.GET("/get", s.getStruct)
 	structGroup.GET("/get/:name", s.getStruct)
 	structGroup.POST("/put", s.putStruct)
+	structGroup.POST("/discover", s.discoverStruct)
+	structGroup.GET("/ddl/:name", s.getDDL)
 
 	parserGroup := e.Group("/parser")
 	parserGroup.POST("/start", s.startParser)
 	parserGroup.POST("/stop", s.stopParser)
+	parserGroup.GET("/schema_changes", s.getSchemaChanges)
 	parserGroup.GET("/stream", s.streamStdout) // websocket
 
 	syncerGroup := e.Group("/syncer")
 	syncerGroup.POST("/start", s.startSyncer)
 	syncerGroup.POST("/stop", s.stopSyncer)
 
-	e.Logger.Fatal(e.Start(address))
+	// records which failed to apply to target db
+	syncerGroup.GET("/dlq/:table", s.getDeadLetters)
+	syncerGroup.GET("/dlq/:table/:id", s.getDeadLetter)
+	syncerGroup.PUT("/dlq/:table/:id", s.editDeadLetter)
+	syncerGroup.POST("/dlq/:table/:id/retry", s.retryDeadLetter)
+	syncerGroup.DELETE("/dlq/:table/:id", s.discardDeadLetter)
+
+	// Prometheus metrics, see package metrics
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	// parser & syncer state, pending records per table
+	e.GET("/status", s.getStatus)
+	e.GET("/status/:table", s.getTableStatus)
+
+	if s.tls == nil {
+		e.Logger.Fatal(e.Start(address))
+	}
+	tlsConfig, err := s.tls.tlsConfig()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	e.TLSServer.Addr = address
+	e.TLSServer.TLSConfig = tlsConfig
+	e.Logger.Fatal(e.StartServer(e.TLSServer))
 }
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOptions of the HTTPS listener, see Options.TLS
+type TLSOptions struct {
+	// CertFile & KeyFile are the PEM encoded server certificate & key
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS: client certificates are verified against the PEM encoded CAs in it (see ClientCertAuth)
+	ClientCAFile string
+	// RequireClientCert rejects connections without a valid client certificate, otherwise it is optional
+	RequireClientCert bool
+}
+
+// tlsConfig builds the config of the HTTPS listener, HTTP/1.1 only so that websocket upgrades (/parser/stream) keep working
+func (o TLSOptions) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Load certificate error: %v", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"http/1.1"},
+	}
+	if o.ClientCAFile == "" {
+		if o.RequireClientCert {
+			return nil, fmt.Errorf("client CA is required to verify client certificates")
+		}
+		return cfg, nil
+	}
+
+	pem, err := ioutil.ReadFile(o.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("Load client CA error: %v", err)
+	}
+	cfg.ClientCAs = x509.NewCertPool()
+	if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("Failed to parse client CA, please check validity of %v", o.ClientCAFile)
+	}
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if o.RequireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
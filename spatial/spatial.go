@@ -0,0 +1,50 @@
+// Package spatial provides the Go types of MySQL spatial columns (GEOMETRY, POINT, LINESTRING, POLYGON...),
+// synced to MSSQL geometry or geography columns
+package spatial
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DefaultGeographySRID is the SRID of Geography values without one (SRID 0 in MySQL): WGS 84,
+// as MSSQL geography requires a geographic SRID
+const DefaultGeographySRID = 4326
+
+// Geometry is a spatial value synced to a MSSQL geometry column
+type Geometry struct {
+	// SRID of the coordinates, 0 if the column has none
+	SRID uint32
+	// WKB is the well-known binary representation of the value
+	WKB []byte
+}
+
+// Geography is a spatial value synced to a MSSQL geography column,
+// its coordinates are longitudes & latitudes (as MySQL stores them, whatever the axis order of SRID)
+type Geography Geometry
+
+// Parse parses `b`, a spatial value in MySQL's internal format: SRID (4 bytes, little-endian) followed by WKB
+func Parse(b []byte) (Geometry, error) {
+	// SRID + WKB byte order + WKB geometry type
+	if len(b) < 9 {
+		return Geometry{}, fmt.Errorf("spatial value too short (%d bytes)", len(b))
+	}
+	wkb := b[4:]
+	var order binary.ByteOrder
+	switch wkb[0] {
+	case 0:
+		order = binary.BigEndian
+	case 1:
+		order = binary.LittleEndian
+	default:
+		return Geometry{}, fmt.Errorf("invalid WKB byte order %d", wkb[0])
+	}
+	// Point, LineString, Polygon, MultiPoint, MultiLineString, MultiPolygon or GeometryCollection
+	if t := order.Uint32(wkb[1:]); t < 1 || t > 7 {
+		return Geometry{}, fmt.Errorf("invalid WKB geometry type %d", t)
+	}
+	return Geometry{
+		SRID: binary.LittleEndian.Uint32(b),
+		WKB:  append([]byte(nil), wkb...),
+	}, nil
+}
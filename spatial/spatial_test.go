@@ -0,0 +1,30 @@
+package spatial
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	// SELECT ST_GeomFromText('POINT(1 2)', 4326) in MySQL's internal format
+	b, _ := hex.DecodeString("E6100000" + "0101000000000000000000F03F0000000000000040")
+	g, err := Parse(b)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if g.SRID != 4326 || !bytes.Equal(g.WKB, b[4:]) {
+		t.Errorf("Expected SRID 4326 & WKB %x, Actual: %v %x", b[4:], g.SRID, g.WKB)
+	}
+	b[4] = 0
+	if g.WKB[0] != 1 {
+		t.Error("Expected WKB to be copied")
+	}
+
+	for _, invalid := range []string{"", "00000000", "000000000201000000", "000000000100000000", "000000000108000000"} {
+		b, _ := hex.DecodeString(invalid)
+		if _, err := Parse(b); err == nil {
+			t.Errorf("%v - Expected error", invalid)
+		}
+	}
+}
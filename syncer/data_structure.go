@@ -1,9 +1,12 @@
 package syncer
 
 import (
+	"encoding/json"
 	"fmt"
+	"mysql2mssql/spatial"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/shopspring/decimal"
 )
@@ -32,6 +35,10 @@ func getColumns(model interface{}, onlyPrimary bool) (columns []column, values [
 		if colName = parsedTag[1]; colName == "column" || colName == "" {
 			continue
 		}
+		// name of the column in target db, if different from source db
+		if target := structType.Field(k).Tag.Get("target"); target != "" {
+			colName = target
+		}
 
 		var isPrimaryKey bool
 		if len(parsedTag) > 2 && parsedTag[2] == "primaryKey" {
@@ -50,15 +57,24 @@ func getColumns(model interface{}, onlyPrimary bool) (columns []column, values [
 				fieldType:    fieldType,
 			})
 
-			if field.Kind() == reflect.Ptr && field.IsNil() {
+			if strings.HasPrefix(strings.TrimPrefix(fieldType, "*"), "spatial.") {
+				// 2 parameters, see `placeholder`
+				values = append(values, spatialArgs(field)...)
+			} else if field.Kind() == reflect.Ptr && field.IsNil() {
 				values = append(values, nil)
 			} else {
 				// MSSQL does not have a matching type for uint64, so we try to convert it to Decimal (21)
 				// 	when the int is bigger than 8 bytes (this MSSQL driver does not do that implicitly)
 				var fieldValue interface{}
-				if (fieldType == "uint" || fieldType == "*uint") && reflect.Indirect(field).Uint() > 9223372036854775807 {
+				if isUint64(fieldType) && reflect.Indirect(field).Uint() > 9223372036854775807 {
 					dec, _ := decimal.NewFromString(fmt.Sprint(reflect.Indirect(field).Uint()))
 					fieldValue = dec
+				} else if fieldType == "time.Duration" || fieldType == "*time.Duration" {
+					// the driver would send a Duration as bigint
+					fieldValue = timeText(time.Duration(reflect.Indirect(field).Int()))
+				} else if strings.TrimPrefix(fieldType, "*") == rawMessageType {
+					// the driver would send JSON text as varbinary
+					fieldValue = jsonText(reflect.Indirect(field).Bytes())
 				} else {
 					fieldValue = field.Interface()
 				}
@@ -69,9 +85,54 @@ func getColumns(model interface{}, onlyPrimary bool) (columns []column, values [
 	return
 }
 
+// timeText renders MySQL TIME value `d` as "[-]hh:mm:ss.ffffff" (hh has 3 digits over 99 hours), MSSQL time only holds
+// a time of day, whereas TIME ranges from -838:59:59 to 838:59:59
+func timeText(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, d/time.Hour, d/time.Minute%60, d/time.Second%60, d%time.Second/time.Microsecond)
+}
+
+// name of the type of JSON fields, which depends on Go version
+var rawMessageType = reflect.TypeOf(json.RawMessage{}).String()
+
+// jsonText returns JSON text `b` as string, "null" if it is empty
+func jsonText(b []byte) string {
+	if len(b) == 0 {
+		return "null"
+	}
+	return string(b)
+}
+
+// isUint64 returns true if `fieldType` is uint or uint64 (or a pointer to them), whose values may overflow bigint
+func isUint64(fieldType string) bool {
+	switch strings.TrimPrefix(fieldType, "*") {
+	case "uint", "uint64":
+		return true
+	}
+	return false
+}
+
+// spatialArgs returns the WKB & SRID of spatial field `field` (spatial.Geometry or spatial.Geography), nil if it is NULL
+func spatialArgs(field reflect.Value) []value {
+	if field.Kind() == reflect.Ptr && field.IsNil() {
+		return []value{nil, nil}
+	}
+	v := reflect.Indirect(field)
+	g := v.Convert(reflect.TypeOf(spatial.Geometry{})).Interface().(spatial.Geometry)
+	srid := int64(g.SRID)
+	if srid == 0 && v.Type() == reflect.TypeOf(spatial.Geography{}) {
+		srid = spatial.DefaultGeographySRID
+	}
+	return []value{g.WKB, srid}
+}
+
 // returns array of parsed tags, assuming input `tags` follow convention
 // example:
 //	`gorm:"column:pkCol;primaryKey"` // tags separator must be ";", first tag must be "column:...", second tag primaryKey is optional
+//	`gorm:"column:pk_col;primaryKey" target:"PkCol"` // tag target is the column name in target db (optional)
 func parseTagSetting(tags reflect.StructTag) []string {
 	values := strings.SplitN(tags.Get("gorm"), ";", 2)
 	colInfo := strings.SplitN(values[0], ":", 2)
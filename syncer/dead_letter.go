@@ -0,0 +1,247 @@
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+// prefix of dead letter buckets, one bucket per table; key: DeadLetter.ID
+const deadLetterBucket = "dlq:"
+
+// bucket of journal sequences which have been dead-lettered, see `Store.SkipJournalRecord`
+const journalSkipBucket = "journal_skip"
+
+// DeadLetter is a logged record that failed to apply to target db, moved out of the stream so that the other records can continue.
+// Models are stored as JSON (keyed by datamodel field names), so they can be edited before retrying
+type DeadLetter struct {
+	ID       string          `json:"id"`
+	Table    string          `json:"table"`
+	Action   Action          `json:"action"`
+	Old      json.RawMessage `json:"old,omitempty"`
+	New      json.RawMessage `json:"new,omitempty"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	Time     time.Time       `json:"time"`
+}
+
+var (
+	lastDeadLetterID int64
+	deadLetterIDLock sync.Mutex
+)
+
+// newDeadLetterID returns an unique, time-ordered id
+func newDeadLetterID() string {
+	deadLetterIDLock.Lock()
+	defer deadLetterIDLock.Unlock()
+	id := time.Now().UnixNano()
+	if id <= lastDeadLetterID {
+		id = lastDeadLetterID + 1
+	}
+	lastDeadLetterID = id
+	return strconv.FormatInt(id, 10)
+}
+
+func newDeadLetter(table string, rec *Record, cause error) (*DeadLetter, error) {
+	d := &DeadLetter{
+		ID:       newDeadLetterID(),
+		Table:    table,
+		Action:   rec.Action,
+		Error:    cause.Error(),
+		Attempts: 1,
+		Time:     time.Now(),
+	}
+	var err error
+	if rec.Old != nil {
+		if d.Old, err = json.Marshal(rec.Old); err != nil {
+			return nil, fmt.Errorf("Marshal error: %v", err)
+		}
+	}
+	if rec.New != nil {
+		if d.New, err = json.Marshal(rec.New); err != nil {
+			return nil, fmt.Errorf("Marshal error: %v", err)
+		}
+	}
+	return d, nil
+}
+
+// record decodes the dead letter back into a Record, models are decoded into the type of `model`
+func (d *DeadLetter) record(model interface{}) (rec *Record, err error) {
+	rec = &Record{Action: d.Action, Table: d.Table}
+	t := reflect.TypeOf(model).Elem()
+	if len(d.Old) > 0 {
+		rec.Old = reflect.New(t).Interface()
+		if err = json.Unmarshal(d.Old, rec.Old); err != nil {
+			return nil, fmt.Errorf("Unmarshal error: %v", err)
+		}
+	}
+	if len(d.New) > 0 {
+		rec.New = reflect.New(t).Interface()
+		if err = json.Unmarshal(d.New, rec.New); err != nil {
+			return nil, fmt.Errorf("Unmarshal error: %v", err)
+		}
+	}
+	return
+}
+
+// recordErrorNumbers are the SQL Server errors raised by the values of a row, other rows may still succeed
+// (https://docs.microsoft.com/en-us/sql/relational-databases/errors-events/database-engine-events-and-errors)
+var recordErrorNumbers = map[int32]bool{
+	220:  true, // arithmetic overflow for data type
+	245:  true, // conversion failed
+	515:  true, // cannot insert NULL into a NOT NULL column
+	547:  true, // foreign key or check constraint violation
+	2601: true, // duplicate key in unique index
+	2627: true, // primary key or unique constraint violation
+	2628: true, // string or binary data would be truncated (SQL Server 2019)
+	8114: true, // error converting data type
+	8115: true, // arithmetic overflow converting to data type
+	8152: true, // string or binary data would be truncated
+}
+
+// isRecordError returns true if target db rejected the record itself (e.g. constraint violation, data truncation),
+// errors such as connection loss, deadlocks or a missing target table are not specific to a record & stop the syncer
+func isRecordError(err error) bool {
+	var sqlErr mssql.Error
+	return errors.As(err, &sqlErr) && recordErrorNumbers[sqlErr.Number]
+}
+
+// PutDeadLetter adds or overrides a dead letter
+func (s *Store) PutDeadLetter(d *DeadLetter) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("Marshal error: %v", err)
+	}
+	return s.LocalDb.Put(deadLetterBucket+d.Table, d.ID, b, 0)
+}
+
+// DeadLetters returns the dead letters of `targetTable`, oldest first
+func (s *Store) DeadLetters(targetTable string) ([]*DeadLetter, error) {
+	entries, err := s.LocalDb.GetAll(deadLetterBucket + targetTable)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*DeadLetter, 0, len(entries))
+	for _, e := range entries {
+		d := &DeadLetter{}
+		if err = json.Unmarshal(e.Value, d); err != nil {
+			return nil, fmt.Errorf("Unmarshal error: %v", err)
+		}
+		list = append(list, d)
+	}
+	// ids are time-ordered & of same length
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// DeadLetter returns a dead letter of `targetTable`, nil if not found
+func (s *Store) DeadLetter(targetTable string, id string) (*DeadLetter, error) {
+	b, err := s.LocalDb.Get(deadLetterBucket+targetTable, id)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	d := &DeadLetter{}
+	if err = json.Unmarshal(b, d); err != nil {
+		return nil, fmt.Errorf("Unmarshal error: %v", err)
+	}
+	return d, nil
+}
+
+// EditDeadLetter replaces the models of a dead letter (nil keeps the current one),
+// `old` & `new` must be decodable into the model of `targetTable`
+func (s *Store) EditDeadLetter(targetTable string, id string, old json.RawMessage, new json.RawMessage) (*DeadLetter, error) {
+	d, err := s.DeadLetter(targetTable, id)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	if old != nil {
+		d.Old = old
+	}
+	if new != nil {
+		d.New = new
+	}
+	model := s.Model(targetTable)
+	if model == nil {
+		return nil, fmt.Errorf("model of %v is not defined", targetTable)
+	}
+	if _, err = d.record(model); err != nil {
+		return nil, err
+	}
+	return d, s.PutDeadLetter(d)
+}
+
+// DeleteDeadLetter discards a dead letter
+func (s *Store) DeleteDeadLetter(targetTable string, id string) error {
+	return s.LocalDb.Delete(deadLetterBucket+targetTable, id)
+}
+
+// SkipJournalRecord marks the journal record at `seq` as dead-lettered, it is skipped by the syncer
+func (s *Store) SkipJournalRecord(seq uint64) error {
+	return s.LocalDb.Put(journalSkipBucket, strconv.FormatUint(seq, 10), []byte{1}, 0)
+}
+
+// journalSkips returns the sequences of dead-lettered journal records
+func (s *Store) journalSkips() (map[uint64]bool, error) {
+	entries, err := s.LocalDb.GetAll(journalSkipBucket)
+	if err != nil {
+		return nil, err
+	}
+	skips := make(map[uint64]bool, len(entries))
+	for _, e := range entries {
+		seq, err := strconv.ParseUint(e.Key, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		skips[seq] = true
+	}
+	return skips, nil
+}
+
+// RetryDeadLetter applies a dead letter again, it is discarded on success,
+// otherwise the error & attempt count are updated
+func (s *Syncer) RetryDeadLetter(table string, id string) error {
+	d, err := s.store.DeadLetter(table, id)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return fmt.Errorf("dead letter %v of %v not found", id, table)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	model := s.store.Model(table)
+	if model == nil {
+		return fmt.Errorf("model of %v is not defined", table)
+	}
+	rec, err := d.record(model)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Begin transaction error: %v", err.Error())
+	}
+	if err = s.apply(tx, table, rec); err == nil {
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("Commit error: %v", err.Error())
+		}
+		return s.store.DeleteDeadLetter(table, id)
+	}
+	tx.Rollback()
+
+	d.Attempts++
+	d.Error = err.Error()
+	d.Time = time.Now()
+	if putErr := s.store.PutDeadLetter(d); putErr != nil {
+		return putErr
+	}
+	return err
+}
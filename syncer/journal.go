@@ -0,0 +1,205 @@
+package syncer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"mysql2mssql/metrics"
+	"strconv"
+)
+
+// journal is the global, sequenced event log used when `Store.Ordered` is true,
+// events of all tables are logged into one list in source commit order, separated by commit markers.
+// 1 journal record stores encoded bytes in following format: [action | seq | table | new data | old data]
+const (
+	journalBucket = "journal"
+	journalKey    = "journal"
+	// key of the last persisted sequence in journalBucket
+	journalSeqKey = "seq"
+)
+
+// EnableJournal switches Store to log events of all tables into the global journal,
+// records of a source transaction that was not committed (e.g. the parser was stopped halfway) are aborted
+func (s *Store) EnableJournal() error {
+	s.Ordered = true
+	if b, err := s.LocalDb.Get(journalBucket, journalSeqKey); err != nil {
+		return err
+	} else if b != nil {
+		if _, err = fmt.Sscan(string(b), &s.seq); err != nil {
+			return fmt.Errorf("Invalid journal sequence: %v", err)
+		}
+	}
+
+	tail, err := s.LocalDb.GetRange(journalBucket, journalKey, -1, -1)
+	if err != nil || len(tail) == 0 {
+		return err
+	}
+	rec := &Record{}
+	if err = s.decodeJournal(tail[0], rec); err != nil {
+		return err
+	}
+	if rec.Seq > s.seq {
+		s.seq = rec.Seq
+	}
+	if rec.Action != CommitAction && rec.Action != AbortAction {
+		return s.logMarker(AbortAction)
+	}
+	return nil
+}
+
+// LogCommit marks the end of a source transaction in journal,
+// it is a no-op if no record has been logged since last commit
+func (s *Store) LogCommit() error {
+	if !s.Ordered || !s.inTx {
+		return nil
+	}
+	return s.logMarker(CommitAction)
+}
+
+// GetJournal returns `limit` journal records starting from index `start`, callback is fired once per record
+func (s *Store) GetJournal(start int, limit int, callback func(rec *Record) error) (err error) {
+	if size, err := s.JournalSize(); err != nil || start >= size {
+		return err
+	}
+	list, err := s.LocalDb.GetRange(journalBucket, journalKey, start, start+limit-1)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		rec := &Record{}
+		if err = s.decodeJournal(list[i], rec); err != nil {
+			return err
+		}
+		if err = callback(rec); err != nil {
+			return fmt.Errorf("%w - forEach loop forcibly stopped", err)
+		}
+	}
+	return
+}
+
+// JournalSize get current "sync-pending" records in journal
+func (s *Store) JournalSize() (int, error) {
+	return s.LocalDb.Size(journalBucket, journalKey)
+}
+
+// TrimJournal removes `count` records from the head of journal,
+// along with the skip marks of the removed dead-lettered records, see `SkipJournalRecord`
+func (s *Store) TrimJournal(count int) error {
+	if count <= 0 {
+		return nil
+	}
+	last, err := s.LocalDb.GetRange(journalBucket, journalKey, count-1, count-1)
+	if err != nil || len(last) == 0 {
+		return err
+	}
+	if err = s.LocalDb.Rem(journalBucket, journalKey, count); err != nil {
+		return err
+	}
+	s.updateJournalPending()
+	seq, err := journalSeq(last[0])
+	if err != nil {
+		return err
+	}
+	skips, err := s.journalSkips()
+	if err != nil {
+		return err
+	}
+	for skip := range skips {
+		if skip <= seq {
+			if err = s.LocalDb.Delete(journalSkipBucket, strconv.FormatUint(skip, 10)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateJournalPending exports the number of journal records waiting to be synced, see `metrics.PendingRecords`
+func (s *Store) updateJournalPending() {
+	size, _ := s.JournalSize()
+	metrics.PendingRecords.WithLabelValues(journalKey).Set(float64(size))
+}
+
+func (s *Store) logJournal(targetTable string, rec *Record) error {
+	s.seq++
+	b, err := encodeJournal(s.seq, targetTable, rec)
+	if err != nil {
+		return fmt.Errorf("Marshal error: %v", err)
+	}
+	s.inTx = true
+	return s.LocalDb.Push(journalBucket, journalKey, b)
+}
+
+func (s *Store) logMarker(act Action) error {
+	s.seq++
+	b, err := encodeJournal(s.seq, "", &Record{Action: act})
+	if err != nil {
+		return fmt.Errorf("Marshal error: %v", err)
+	}
+	if err = s.LocalDb.Push(journalBucket, journalKey, b); err != nil {
+		return err
+	}
+	s.updateJournalPending()
+	s.inTx = false
+	return s.LocalDb.Put(journalBucket, journalSeqKey, []byte(fmt.Sprint(s.seq)), 0)
+}
+
+func encodeJournal(seq uint64, table string, rec *Record) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	enc := gob.NewEncoder(buffer)
+	for _, v := range []interface{}{rec.Action, seq, table} {
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+	}
+	for _, model := range []interface{}{rec.New, rec.Old} {
+		if model == nil {
+			continue
+		}
+		if err := enc.Encode(model); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// journalSeq decodes the sequence of a journal record, regardless of its model
+func journalSeq(input []byte) (seq uint64, err error) {
+	dec := gob.NewDecoder(bytes.NewBuffer(input))
+	var act Action
+	for _, v := range []interface{}{&act, &seq} {
+		if err = dec.Decode(v); err != nil {
+			return 0, fmt.Errorf("Decode error: %v", err)
+		}
+	}
+	return seq, nil
+}
+
+// decodeJournal decodes a journal record, models are decoded into the type of `Store.Model(table)`
+func (s *Store) decodeJournal(input []byte, rec *Record) (err error) {
+	dec := gob.NewDecoder(bytes.NewBuffer(input))
+	for _, v := range []interface{}{&rec.Action, &rec.Seq, &rec.Table} {
+		if err = dec.Decode(v); err != nil {
+			return fmt.Errorf("Decode error: %v", err)
+		}
+	}
+	if rec.Action == CommitAction || rec.Action == AbortAction {
+		return nil
+	}
+
+	model := s.Model(rec.Table)
+	if model == nil {
+		return fmt.Errorf("Decode error: model of %v is not defined", rec.Table)
+	}
+	if rec.Action == InsertAction || rec.Action == UpdateAction {
+		if rec.New, err = decode(dec, model); err != nil {
+			return err
+		}
+	}
+	if rec.Action == UpdateAction || rec.Action == DeleteAction {
+		if rec.Old, err = decode(dec, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
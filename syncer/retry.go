@@ -0,0 +1,133 @@
+package syncer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/siddontang/go-log/log"
+)
+
+// default retry settings, see TargetDbConfig
+const (
+	defaultMaxRetries       = 5
+	defaultRetryInterval    = time.Second
+	defaultMaxRetryInterval = time.Minute
+	defaultRetryJitter      = 0.2
+)
+
+// transientErrorNumbers are the SQL Server errors which may succeed when retried, such as deadlocks, lock timeouts & failovers
+// (https://docs.microsoft.com/en-us/azure/azure-sql/database/troubleshoot-common-errors-issues)
+var transientErrorNumbers = map[int32]bool{
+	64:    true, // connection was closed by the server
+	233:   true, // no process is on the other end of the pipe
+	1205:  true, // deadlock victim
+	1222:  true, // lock request time out
+	3960:  true, // snapshot isolation update conflict
+	4060:  true, // cannot open database (database is being recovered)
+	4221:  true, // login to read-secondary failed due to long wait on HADR_DATABASE_WAIT_FOR_TRANSITION_TO_VERSIONING
+	10053: true, // transport-level error
+	10054: true, // connection reset by peer
+	10060: true, // network timeout
+	10928: true, // resource limit reached
+	10929: true, // resource limit reached
+	40143: true, // service encountered an error processing the request
+	40197: true, // service encountered an error processing the request (reconfiguration)
+	40501: true, // service is busy
+	40540: true, // service encountered an error processing the request
+	40613: true, // database is not currently available
+	49918: true, // not enough resources to process request
+	49919: true, // too many create/update operations in progress
+	49920: true, // too many operations in progress
+}
+
+// isTransientError returns true if a failed operation may succeed when retried
+func isTransientError(err error) bool {
+	var sqlErr mssql.Error
+	if errors.As(err, &sqlErr) {
+		return transientErrorNumbers[sqlErr.Number]
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError returns true if the connection to target db is broken
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	var streamErr mssql.StreamError
+	return errors.As(err, &netErr) || errors.As(err, &streamErr)
+}
+
+// errSyncerStopped is returned when the syncer is stopped while waiting to retry
+var errSyncerStopped = errors.New("syncer stopped")
+
+// retry runs `sync` & removes the records it has processed with `remove`,
+// `sync` is run again after an exponential backoff as long as it fails on transient errors, up to `MaxRetries` times.
+// The connection pool is rebuilt on connection errors
+func (s *Syncer) retry(sync func() (count int, err error), remove func(count int) error, isTest bool) error {
+	for attempt := 1; ; attempt++ {
+		count, err := sync()
+		if count > 0 && !isTest {
+			if err := remove(count); err != nil {
+				log.Panicf("Error in removing synced records: %v", err)
+			}
+		}
+		if err == nil || !isTransientError(err) || attempt > s.cfg.MaxRetries {
+			return err
+		}
+
+		s.setError(err)
+		wait := s.backoff(attempt)
+		log.Warnf("transient error: %v - retrying in %v (%d/%d)", err.Error(), wait, attempt, s.cfg.MaxRetries)
+		if isConnectionError(err) {
+			s.reconnect()
+		}
+		if !s.sleep(wait) {
+			return errSyncerStopped
+		}
+	}
+}
+
+// backoff returns the wait before retry number `attempt` (starts from 1)
+func (s *Syncer) backoff(attempt int) time.Duration {
+	wait := float64(s.cfg.RetryInterval) * math.Pow(2, float64(attempt-1))
+	if wait > float64(s.cfg.MaxRetryInterval) {
+		wait = float64(s.cfg.MaxRetryInterval)
+	}
+	wait *= 1 + s.cfg.RetryJitter*(2*rand.Float64()-1)
+	return time.Duration(wait)
+}
+
+// sleep waits for `d`, returns false if the syncer is stopped meanwhile
+func (s *Syncer) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.jobQuitSignal:
+		// hand the signal over to the scheduler
+		s.jobQuitSignal <- struct{}{}
+		return false
+	}
+}
+
+// reconnect rebuilds the connection pool, cached statements are prepared again on next use
+func (s *Syncer) reconnect() {
+	for _, stmts := range []map[string]*sql.Stmt{s.insertStmts, s.updateStmts, s.deleteStmts, s.mergeStmts} {
+		for table, stmt := range stmts {
+			stmt.Close()
+			delete(stmts, table)
+		}
+	}
+	s.db.Close()
+	s.db = buildConn(s.cfg)
+}
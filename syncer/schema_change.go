@@ -0,0 +1,109 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// bucket of source schema changes history, see `Store.LogSchemaChange`
+	schemaChangeBucket = "schema_change"
+	// bucket of paused tables, key: table name, value: reason
+	pausedBucket = "paused"
+	// bucket of T-SQL statements to run on target db before syncing a table, key: table name
+	alterBucket = "alter"
+)
+
+// SchemaChange is the drift between a datamodel & its source table, recorded after a DDL event on source db
+type SchemaChange struct {
+	Time   time.Time `json:"time"`
+	Schema string    `json:"schema"`
+	Table  string    `json:"table"`
+	// Model is the key of the datamodel, "schema.table" or "table"
+	Model string `json:"model"`
+	// Query is the DDL statement
+	Query string `json:"query"`
+	// TableDropped is true if the source table no longer exists (dropped or renamed)
+	TableDropped   bool     `json:"table_dropped,omitempty"`
+	AddedColumns   []string `json:"added_columns,omitempty"`
+	MissingColumns []string `json:"missing_columns,omitempty"`
+	// Policy is the schema change policy applied
+	Policy string `json:"policy"`
+	// Result of applying the policy
+	Result string `json:"result"`
+}
+
+// LogSchemaChange appends a schema change to history
+func (s *Store) LogSchemaChange(c SchemaChange) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("Marshal error: %v", err)
+	}
+	return s.LocalDb.Push(schemaChangeBucket, schemaChangeBucket, b)
+}
+
+// SchemaChanges returns the history of schema changes, oldest first
+func (s *Store) SchemaChanges() (changes []SchemaChange, err error) {
+	list, err := s.LocalDb.GetAllKey(schemaChangeBucket, schemaChangeBucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range list {
+		c := SchemaChange{}
+		if err = json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("Unmarshal error: %v", err)
+		}
+		changes = append(changes, c)
+	}
+	return
+}
+
+// Pause stops syncing `targetTable` until `Resume` is called, changes are still logged
+func (s *Store) Pause(targetTable string, reason string) error {
+	return s.LocalDb.Put(pausedBucket, targetTable, []byte(reason), 0)
+}
+
+// Resume syncing `targetTable`
+func (s *Store) Resume(targetTable string) error {
+	return s.LocalDb.Delete(pausedBucket, targetTable)
+}
+
+// PausedTables returns paused tables & the reasons
+func (s *Store) PausedTables() (map[string]string, error) {
+	entries, err := s.LocalDb.GetAll(pausedBucket)
+	if err != nil {
+		return nil, err
+	}
+	paused := make(map[string]string, len(entries))
+	for _, e := range entries {
+		paused[e.Key] = string(e.Value)
+	}
+	return paused, nil
+}
+
+// LogAlter queues a statement altering `targetTable` on target db, it is run before the next sync of the table
+func (s *Store) LogAlter(targetTable string, stmt string) error {
+	return s.LocalDb.Push(alterBucket, targetTable, []byte(stmt))
+}
+
+// GetAlters returns the queued statements altering `targetTable`
+func (s *Store) GetAlters(targetTable string) (stmts []string, err error) {
+	// nutsdb returns an error on missing list
+	if size, err := s.LocalDb.Size(alterBucket, targetTable); err != nil || size == 0 {
+		return nil, nil
+	}
+	list, err := s.LocalDb.GetAllKey(alterBucket, targetTable)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range list {
+		stmts = append(stmts, string(b))
+	}
+	return
+}
+
+// RemAlters removes the first `count` queued statements altering `targetTable`
+func (s *Store) RemAlters(targetTable string, count int) error {
+	return s.LocalDb.Rem(alterBucket, targetTable, count)
+}
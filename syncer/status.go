@@ -0,0 +1,80 @@
+package syncer
+
+import (
+	"sort"
+	"time"
+)
+
+// Status is a snapshot of the scheduled job's state
+type Status struct {
+	// Running is true while the scheduled job is running, it stops on `Stop` or a permanent error
+	Running bool `json:"running"`
+	// LastSync is the end of the last sync pass that completed without error
+	LastSync *time.Time `json:"last_sync,omitempty"`
+	// LastError is the last error met by a sync pass, including retried ones
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// Status returns the current state of the scheduled job
+func (s *Syncer) Status() Status {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	return s.status
+}
+
+func (s *Syncer) setRunning(running bool) {
+	s.statusMu.Lock()
+	s.status.Running = running
+	s.statusMu.Unlock()
+}
+
+// setSynced records a sync pass completed without error
+func (s *Syncer) setSynced() {
+	now := time.Now()
+	s.statusMu.Lock()
+	s.status.LastSync = &now
+	s.statusMu.Unlock()
+}
+
+func (s *Syncer) setError(err error) {
+	now := time.Now()
+	s.statusMu.Lock()
+	s.status.LastError = err.Error()
+	s.status.LastErrorTime = &now
+	s.statusMu.Unlock()
+}
+
+// TableStatus is the sync state of a target table in store
+type TableStatus struct {
+	// Pending is the number of logged records waiting to be synced, 0 with journal enabled (see `Store.JournalSize`)
+	Pending     int `json:"pending"`
+	DeadLetters int `json:"dead_letters"`
+	// Paused is the reason why syncing the table is paused, empty if not paused
+	Paused string `json:"paused,omitempty"`
+}
+
+// TableStatus returns the sync state of `targetTable`
+func (s *Store) TableStatus(targetTable string) (status TableStatus, err error) {
+	// nutsdb returns an error on missing list
+	status.Pending, _ = s.Size(targetTable)
+	deadLetters, err := s.LocalDb.GetAll(deadLetterBucket + targetTable)
+	if err != nil {
+		return
+	}
+	status.DeadLetters = len(deadLetters)
+	reason, err := s.LocalDb.Get(pausedBucket, targetTable)
+	status.Paused = string(reason)
+	return
+}
+
+// Tables returns the names of target tables which have a model defined, sorted
+func (s *Store) Tables() []string {
+	models := s.models()
+	tables := make([]string, 0, len(models))
+	for table := range models {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
@@ -2,9 +2,12 @@ package syncer
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"mysql2mssql/db"
+	"mysql2mssql/metrics"
 	"reflect"
+	"sync"
 
 	"encoding/gob"
 )
@@ -19,18 +22,51 @@ const (
 	UpdateAction
 	// DeleteAction - 1 log record in .dat file stores encoded bytes in following format: [action | deleted data]
 	DeleteAction
+	// CommitAction - only in journal, marks the end of a source transaction: [action | seq]
+	CommitAction
+	// AbortAction - only in journal, discards the records of an unfinished source transaction before it: [action | seq]
+	AbortAction
 )
 
+func (a Action) String() string {
+	switch a {
+	case InsertAction:
+		return "insert"
+	case UpdateAction:
+		return "update"
+	case DeleteAction:
+		return "delete"
+	case CommitAction:
+		return "commit"
+	case AbortAction:
+		return "abort"
+	}
+	return fmt.Sprintf("Action(%d)", uint8(a))
+}
+
 // Record contains old & new data
 type Record struct {
 	Action Action
 	// only available in update events
 	Old interface{}
 	New interface{}
+	// Table & Seq are only available in journal records, see `Store.EnableJournal`
+	Table string
+	Seq   uint64
 }
 
 const bucket = "store"
 
+// bucket for binlog checkpoint, see `Store.SaveCheckpoint`
+const checkpointBucket = "checkpoint"
+
+// Checkpoint is the last binlog position which all events before it have been logged into Store
+type Checkpoint struct {
+	Name    string `json:"name"`
+	Pos     uint32 `json:"pos"`
+	GTIDSet string `json:"gtid_set,omitempty"`
+}
+
 // ModelDefinitions defines table structure, see package server.StructRequest
 type ModelDefinitions = map[string]interface{}
 
@@ -38,6 +74,16 @@ type ModelDefinitions = map[string]interface{}
 type Store struct {
 	LocalDb db.Interface
 	Models  ModelDefinitions
+	// Ordered is true when events are logged into one global journal instead of one list per table
+	Ordered bool
+	// last journal sequence
+	seq uint64
+	// true if journal records were logged after the last commit
+	inTx bool
+	// name of the table in target db of each table, see `SetTarget`
+	targets map[string]string
+	// guards Models & targets, which can be changed while syncing (see `SetModel`)
+	mu sync.RWMutex
 }
 
 // DefaultStore use inmemdb
@@ -60,6 +106,58 @@ func NewStore(db db.Interface, models ModelDefinitions) *Store {
 	}
 }
 
+// Model returns the model of `targetTable`
+func (s *Store) Model(targetTable string) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Models[targetTable]
+}
+
+// SetModel adds or replaces the model of `targetTable`, safe to call while syncing
+func (s *Store) SetModel(targetTable string, model interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Models[targetTable] = model
+}
+
+// Target returns the name of the table in target db which `targetTable` is synced to,
+// `targetTable` itself if it has not been set with `SetTarget`
+func (s *Store) Target(targetTable string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if target := s.targets[targetTable]; target != "" {
+		return target
+	}
+	return targetTable
+}
+
+// SetTarget maps `targetTable` to a table of another name (optionally schema-qualified, see `TableName`) in target db,
+// an empty `target` removes the mapping. Safe to call while syncing, should be called before `SetModel`
+// so that the statements cached for the previous model are rebuilt with it
+func (s *Store) SetTarget(targetTable string, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.targets == nil {
+		s.targets = make(map[string]string)
+	}
+	if target == "" {
+		delete(s.targets, targetTable)
+	} else {
+		s.targets[targetTable] = target
+	}
+}
+
+// models returns a copy of Models
+func (s *Store) models() ModelDefinitions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	models := make(ModelDefinitions, len(s.Models))
+	for table, model := range s.Models {
+		models[table] = model
+	}
+	return models
+}
+
 // Close closes database connection
 func (s *Store) Close() {
 	s.LocalDb.Release()
@@ -73,7 +171,7 @@ func forEach(list [][]byte, model interface{}, callback func(rec *Record) error)
 			return err
 		}
 		if err = callback(rec); err != nil {
-			return fmt.Errorf("%v - forEach loop forcibly stopped", err)
+			return fmt.Errorf("%w - forEach loop forcibly stopped", err)
 		}
 	}
 	return
@@ -88,6 +186,19 @@ func (s *Store) GetAll(targetTable string, mappingModel interface{}, callback fu
 	return forEach(list, mappingModel, callback)
 }
 
+// GetBatch returns the first `limit` values (decoded into mappingModel) in targetTable, callback is fired once per record.
+// If `limit` is less than 1, it is the same as GetAll
+func (s *Store) GetBatch(targetTable string, mappingModel interface{}, limit int, callback func(rec *Record) error) (err error) {
+	if limit < 1 {
+		return s.GetAll(targetTable, mappingModel, callback)
+	}
+	list, err := s.LocalDb.GetRange(bucket, targetTable, 0, limit-1)
+	if err != nil {
+		return err
+	}
+	return forEach(list, mappingModel, callback)
+}
+
 // Size get current "sync-pending" records from local database
 func (s *Store) Size(targetTable string) (size int, err error) {
 	return s.LocalDb.Size(bucket, targetTable)
@@ -95,37 +206,87 @@ func (s *Store) Size(targetTable string) (size int, err error) {
 
 // LRem remove List from left
 func (s *Store) LRem(targetTable string, count int) (err error) {
-	return s.LocalDb.Rem(bucket, targetTable, count)
+	if err = s.LocalDb.Rem(bucket, targetTable, count); err != nil {
+		return
+	}
+	s.updatePending(targetTable)
+	return
+}
+
+// SaveCheckpoint overrides the saved binlog position
+func (s *Store) SaveCheckpoint(c Checkpoint) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("Marshal error: %v", err)
+	}
+	return s.LocalDb.Put(checkpointBucket, checkpointBucket, b, 0)
+}
+
+// LoadCheckpoint returns the saved binlog position, nil if nothing has been saved
+func (s *Store) LoadCheckpoint() (*Checkpoint, error) {
+	b, err := s.LocalDb.Get(checkpointBucket, checkpointBucket)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("Unmarshal error: %v", err)
+	}
+	return c, nil
 }
 
 // LogInsert records the insert event into Store
 func (s *Store) LogInsert(targetTable string, model interface{}) error {
 	rec := &Record{Action: InsertAction, New: model}
+	if s.Ordered {
+		return s.logJournal(targetTable, rec)
+	}
 	b, err := encodeBytes(rec)
 	if err != nil {
 		return fmt.Errorf("Marshal error: %v", err)
 	}
-	return s.LocalDb.Push(bucket, targetTable, b)
+	return s.push(targetTable, b)
 }
 
 // LogUpdate records the update event into Store
 func (s *Store) LogUpdate(targetTable string, oldModel interface{}, newModel interface{}) error {
 	rec := &Record{Action: UpdateAction, Old: oldModel, New: newModel}
+	if s.Ordered {
+		return s.logJournal(targetTable, rec)
+	}
 	b, err := encodeBytes(rec)
 	if err != nil {
 		return fmt.Errorf("Marshal error: %v", err)
 	}
-	return s.LocalDb.Push(bucket, targetTable, b)
+	return s.push(targetTable, b)
 }
 
 // LogDelete records the delete event into Store
 func (s *Store) LogDelete(targetTable string, model interface{}) error {
 	rec := &Record{Action: DeleteAction, Old: model}
+	if s.Ordered {
+		return s.logJournal(targetTable, rec)
+	}
 	b, err := encodeBytes(rec)
 	if err != nil {
 		return fmt.Errorf("Marshal error: %v", err)
 	}
-	return s.LocalDb.Push(bucket, targetTable, b)
+	return s.push(targetTable, b)
+}
+
+func (s *Store) push(targetTable string, b []byte) error {
+	if err := s.LocalDb.Push(bucket, targetTable, b); err != nil {
+		return err
+	}
+	s.updatePending(targetTable)
+	return nil
+}
+
+// updatePending exports the number of records of `targetTable` waiting to be synced
+func (s *Store) updatePending(targetTable string) {
+	// nutsdb returns an error on missing list
+	size, _ := s.Size(targetTable)
+	metrics.PendingRecords.WithLabelValues(targetTable).Set(float64(size))
 }
 
 // truncate target bucket (targetTable)
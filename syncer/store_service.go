@@ -1,7 +1,11 @@
 package syncer
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"mysql2mssql/metrics"
+	"reflect"
 	"time"
 
 	"github.com/siddontang/go-log/log"
@@ -10,13 +14,18 @@ import (
 // Schedule a cronjob that scan the store & try to perform logged action on connected database
 func (s *Syncer) Schedule() {
 	ticker := time.NewTicker(time.Duration(s.interval) * time.Second)
-	s.syncQuitSignal = make(chan struct{})
+	// buffered, so that neither `Stop` nor the job stopping itself (see `stop`) waits for the job
+	quit := make(chan struct{}, 1)
+	s.syncQuitSignal = quit
+	s.jobQuitSignal = quit
+	s.setRunning(true)
 	go func() {
+		defer s.setRunning(false)
 		for {
 			select {
 			case <-ticker.C:
 				s.SyncAllModels(false)
-			case <-s.syncQuitSignal:
+			case <-quit:
 				ticker.Stop()
 				s.Close()
 				return
@@ -25,6 +34,19 @@ func (s *Syncer) Schedule() {
 	}()
 }
 
+// stop the scheduled job after a permanent error, must be called from the job itself
+func (s *Syncer) stop(err error) {
+	if err == errSyncerStopped {
+		return
+	}
+	log.Errorf("error: %v - stopping syncer...", err.Error())
+	s.setError(err)
+	select {
+	case s.jobQuitSignal <- struct{}{}:
+	default: // already stopping, or not scheduled
+	}
+}
+
 // Stop schedule
 func (s *Syncer) Stop() error {
 	if s.syncQuitSignal == nil {
@@ -36,54 +58,314 @@ func (s *Syncer) Stop() error {
 }
 
 // SyncAllModels scan all active records in store & perform syncing actions,
-// if `isTest` is false, then records will be deleted after successful sync
-func (s Syncer) SyncAllModels(isTest bool) {
-	for table, model := range s.store.Models {
-		var size int
-		var count int64
-		var err error
-
-		size, err = s.store.Size(table)
-		if size == 0 {
+// records of each table are applied in batches of `BatchSize` inside one transaction per batch.
+// If `isTest` is false, then records will be deleted after the transaction is committed.
+// A record rejected by target db is moved to the table's dead letters (see `DeadLetter`) & the others continue
+func (s *Syncer) SyncAllModels(isTest bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := time.Now()
+	defer func() { metrics.SyncDuration.Observe(time.Since(start).Seconds()) }()
+	if err := s.syncAllModels(isTest); err != nil {
+		s.stop(err)
+		return
+	}
+	s.setSynced()
+}
+
+func (s *Syncer) syncAllModels(isTest bool) error {
+	models := s.store.models()
+	paused, err := s.store.PausedTables()
+	if err != nil {
+		return err
+	}
+	for table := range models {
+		table := table
+		err := s.retry(func() (int, error) { return 0, s.applyAlters(table) }, nil, isTest)
+		if err != nil {
+			return err
+		}
+	}
+
+	for table, model := range models {
+		if _, ok := paused[table]; ok {
+			continue
+		}
+		if size, _ := s.store.Size(table); size == 0 {
 			continue
 		}
 
-		// TODO: make GetAll async
-		err = s.store.GetAll(table, model, func(rec *Record) error {
-			if rec.Action == InsertAction {
-				_, err = s.Insert(table, rec.New)
-				if err != nil {
-					return fmt.Errorf("Insert error: %v", err.Error())
+		table, model := table, model
+		err := s.retry(func() (int, error) {
+			return s.syncBatch(table, model)
+		}, func(count int) error {
+			// delete exactly the committed (or dead-lettered) records from store
+			return s.store.LRem(table, count)
+		}, isTest)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.store.Ordered {
+		if size, _ := s.store.JournalSize(); size == 0 {
+			return nil
+		}
+		return s.retry(func() (int, error) {
+			return s.syncJournal(paused)
+		}, s.store.TrimJournal, isTest)
+	}
+	return nil
+}
+
+// syncJournal applies journal records in source commit order, each source transaction is committed
+// as one target transaction. Stops at the first commit after `BatchSize` records,
+// records of a transaction whose commit has not been logged yet are left for next run,
+// so are the records from the first transaction touching a paused table.
+// A record rejected by target db is dead-lettered, then its transaction is applied again without it.
+// Returns the number of processed records
+func (s *Syncer) syncJournal(paused map[string]string) (count int, err error) {
+	skips, err := s.store.journalSkips()
+	if err != nil {
+		return 0, err
+	}
+	var tx *sql.Tx
+	var pending int // records in current transaction
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for start := 0; count < s.cfg.BatchSize; start = count + pending {
+		var read int
+		err = s.store.GetJournal(start, s.cfg.BatchSize, func(rec *Record) error {
+			read++
+			switch rec.Action {
+			case CommitAction, AbortAction:
+				if tx != nil {
+					var err error
+					if rec.Action == CommitAction {
+						err = tx.Commit()
+					} else {
+						err = tx.Rollback()
+					}
+					tx = nil
+					if err != nil {
+						return fmt.Errorf("Commit error at seq %d: %w", rec.Seq, err)
+					}
 				}
-			}
-			if rec.Action == UpdateAction {
-				// TODO: currently support UpdateOnPK for now, meaning user MUST define a PK in the datamodel
-				_, err = s.UpdateOnPK(table, rec.Old, rec.New)
-				if err != nil {
-					return fmt.Errorf("Update error: %v", err.Error())
+				count += pending + 1
+				pending = 0
+				if count >= s.cfg.BatchSize {
+					return errStopLoop
 				}
-			}
-			if rec.Action == DeleteAction {
-				// TODO: currently support DeleteOnPK for now, meaning user MUST define a PK in the datamodel
-				_, err = s.DeleteOnPK(table, rec.Old)
-				if err != nil {
-					return fmt.Errorf("Delete error: %v", err.Error())
+			default:
+				if _, ok := paused[rec.Table]; ok {
+					return errStopLoop
+				}
+				if skips[rec.Seq] {
+					pending++
+					return nil
+				}
+				if tx == nil {
+					var err error
+					if tx, err = s.db.Begin(); err != nil {
+						return fmt.Errorf("Begin transaction error: %w", err)
+					}
 				}
+				if err := s.apply(tx, rec.Table, rec); err != nil {
+					if !isRecordError(err) {
+						return fmt.Errorf("%w (seq %d)", err, rec.Seq)
+					}
+					if err = s.deadLetter(rec.Table, rec, err); err != nil {
+						return err
+					}
+					if err = s.store.SkipJournalRecord(rec.Seq); err != nil {
+						return err
+					}
+					skips[rec.Seq] = true
+					return errRestartTx
+				}
+				pending++
 			}
-			if err == nil {
-				count++
-				return nil // return nil continues the loop
+			return nil
+		})
+		if errors.Is(err, errStopLoop) {
+			return count, nil
+		}
+		if errors.Is(err, errRestartTx) {
+			// the failed statement may have doomed the transaction, apply it again from its first record
+			tx.Rollback()
+			tx = nil
+			pending = 0
+			continue
+		}
+		if err != nil || read < s.cfg.BatchSize {
+			return
+		}
+	}
+	return
+}
+
+// applyAlters runs the queued statements altering `table` on target db, see `Store.LogAlter`
+func (s *Syncer) applyAlters(table string) error {
+	stmts, err := s.store.GetAlters(table)
+	if err != nil || len(stmts) == 0 {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err = s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("Alter error: %w (%v)", err, stmt)
+		}
+		log.Infof("altered target table %v: %v", table, stmt)
+	}
+	s.resetStatements(table)
+	return s.store.RemAlters(table, len(stmts))
+}
+
+var (
+	// errStopLoop breaks the store's forEach loop without error
+	errStopLoop = errors.New("stop")
+	// errRestartTx breaks the journal loop to apply current source transaction again
+	errRestartTx = errors.New("restart transaction")
+)
+
+// syncBatch applies the first `BatchSize` records of `table` inside one transaction.
+// If a record is rejected by target db, the records before it are committed & it is dead-lettered.
+// Returns the number of committed & dead-lettered records
+func (s *Syncer) syncBatch(table string, model interface{}) (count int, err error) {
+	count, failed, failedErr, err := s.applyBatch(table, model, s.cfg.BatchSize)
+	if err != nil || failed == nil {
+		return
+	}
+	// the failed statement may have doomed the transaction, apply the records before it again
+	if count > 0 {
+		var again *Record
+		if count, again, failedErr, err = s.applyBatch(table, model, count); err != nil {
+			return 0, err
+		}
+		if again != nil {
+			return 0, fmt.Errorf("%v - record failed on second attempt", failedErr)
+		}
+	}
+	if err = s.deadLetter(table, failed, failedErr); err != nil {
+		return
+	}
+	return count + 1, nil
+}
+
+// applyBatch applies the first `limit` records of `table` inside one transaction & commits it.
+// If a record is rejected by target db, the transaction is rolled back, the record & its error are returned
+// along with the number of records before it
+func (s *Syncer) applyBatch(table string, model interface{}, limit int) (count int, failed *Record, failedErr error, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("Begin transaction error: %w", err)
+	}
+
+	err = s.store.GetBatch(table, model, limit, func(rec *Record) error {
+		if err := s.apply(tx, table, rec); err != nil {
+			if isRecordError(err) {
+				failed, failedErr = rec, err
+				return errStopLoop
 			}
 			return err
-		})
-		// delete from store once success
-		if err == nil && count > 0 && !isTest {
-			if err := s.store.LRem(table, int(count)); err != nil {
-				log.Panicf("Error in removing synced records: %v", err)
+		}
+		count++
+		return nil // return nil continues the loop
+	})
+	if err != nil && failed == nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Errorf("Rollback error: %v", rbErr.Error())
+		}
+		return 0, nil, nil, err
+	}
+	if failed != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Errorf("Rollback error: %v", rbErr.Error())
+		}
+		return count, failed, failedErr, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, nil, nil, fmt.Errorf("Commit error: %w", err)
+	}
+	return
+}
+
+// deadLetter moves a record rejected by target db to the dead letters of `table`
+func (s *Syncer) deadLetter(table string, rec *Record, cause error) error {
+	d, err := newDeadLetter(table, rec, cause)
+	if err != nil {
+		return err
+	}
+	log.Errorf("%v - record moved to dead letters of %v (id %v)", cause, table, d.ID)
+	metrics.DeadLetters.WithLabelValues(table).Inc()
+	return s.store.PutDeadLetter(d)
+}
+
+// apply performs the logged action of `rec` on `table`
+func (s *Syncer) apply(tx *sql.Tx, table string, rec *Record) (err error) {
+	// cached statements are built from the previous model
+	if model := s.store.Model(table); s.models[table] != model {
+		s.resetStatements(table)
+		s.models[table] = model
+	}
+	start := time.Now()
+	defer func() {
+		metrics.StatementDuration.WithLabelValues(rec.Action.String()).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.ApplyErrors.WithLabelValues(table).Inc()
+		} else {
+			metrics.AppliedRecords.WithLabelValues(table, rec.Action.String()).Inc()
+		}
+	}()
+	if s.cfg.ApplyMode == UpsertMode {
+		return s.applyUpsert(tx, table, rec)
+	}
+	switch rec.Action {
+	case InsertAction:
+		if _, err = s.insert(tx, table, rec.New); err != nil {
+			return fmt.Errorf("Insert error: %w", err)
+		}
+	case UpdateAction:
+		// TODO: currently support UpdateOnPK for now, meaning user MUST define a PK in the datamodel
+		if _, err = s.updateOnPK(tx, table, rec.Old, rec.New); err != nil {
+			return fmt.Errorf("Update error: %w", err)
+		}
+	case DeleteAction:
+		// TODO: currently support DeleteOnPK for now, meaning user MUST define a PK in the datamodel
+		if _, err = s.deleteOnPK(tx, table, rec.Old); err != nil {
+			return fmt.Errorf("Delete error: %w", err)
+		}
+	}
+	return
+}
+
+// applyUpsert performs the logged action of `rec` on `table` idempotently:
+// inserts & updates are merged on primary key, deleting a missing row is a no-op
+func (s *Syncer) applyUpsert(tx *sql.Tx, table string, rec *Record) (err error) {
+	switch rec.Action {
+	case InsertAction:
+		if _, err = s.upsert(tx, table, rec.New); err != nil {
+			return fmt.Errorf("Upsert error: %w", err)
+		}
+	case UpdateAction:
+		// the primary key itself is updated, remove the row under the old key first
+		_, oldPks := getColumns(rec.Old, true)
+		_, newPks := getColumns(rec.New, true)
+		if !reflect.DeepEqual(oldPks, newPks) {
+			if _, err = s.deleteOnPK(tx, table, rec.Old); err != nil {
+				return fmt.Errorf("Delete error: %w", err)
 			}
-		} else if err != nil {
-			log.Errorf("error: %v - stopping syncer...", err.Error())
-			s.syncQuitSignal <- struct{}{}
+		}
+		if _, err = s.upsert(tx, table, rec.New); err != nil {
+			return fmt.Errorf("Upsert error: %w", err)
+		}
+	case DeleteAction:
+		if _, err = s.deleteOnPK(tx, table, rec.Old); err != nil {
+			return fmt.Errorf("Delete error: %w", err)
 		}
 	}
+	return
 }
@@ -1,10 +1,17 @@
 package syncer
 
 import (
+	"fmt"
+	"io/ioutil"
+	"mysql2mssql/db"
+	"mysql2mssql/metrics"
+	"os"
 	"reflect"
 	"testing"
 	"time"
 
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dcm "github.com/shopspring/decimal"
 )
 
@@ -21,6 +28,23 @@ func tearDownStore(store *Store) {
 	store.Close()
 }
 
+// newNutsStore returns a Store backed by nutsdb in an empty directory, removed at the end of the test
+func newNutsStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(db.UseNutsDB(db.Options{Dir: dir, SegmentSize: 1024 * 1024}), ModelDefinitions{
+		"StoreTest":  &storeTest{},
+		"SyncerTest": &syncerTest{},
+	})
+	t.Cleanup(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+	return store
+}
+
 func TestStoreInsert(t *testing.T) {
 	store := DefaultStore
 	setUpStore(store)
@@ -228,7 +252,325 @@ func TestStoreDelete(t *testing.T) {
 	}
 }
 
+func TestStoreUnsigned(t *testing.T) {
+	store := DefaultStore
+	setUpStore(store)
+	defer tearDownStore(store)
+
+	small, big := uint16(65535), uint64(18446744073709551615)
+	r := &unsignedTest{ID: 4294967295, Tiny: 255, Small: &small, Big: big, NBig: &big}
+	if err := store.LogInsert("UnsignedTest", r); err != nil {
+		t.Fatalf("LogInsert unsignedTest failed: %v", err)
+	}
+
+	var count uint8
+	err := store.GetAll("UnsignedTest", &unsignedTest{}, func(rec *Record) error {
+		if reflect.DeepEqual(rec.New, r) == false {
+			t.Errorf("Difference in inserted model & retrieved model: \n Expected: %v\n   Actual: %v", r, rec.New)
+		}
+		count++
+		return nil
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("GetAll failed: %v, count: %v", err, count)
+	}
+}
+
+type unsignedTest struct {
+	ID    uint32  `gorm:"column:id;primaryKey"`
+	Tiny  uint8   `gorm:"column:tiny"`
+	Small *uint16 `gorm:"column:small"`
+	Big   uint64  `gorm:"column:big"`
+	NBig  *uint64 `gorm:"column:nbig"`
+}
+
 type storeTest struct {
 	ID   int    `gorm:"column:id;primaryKey"`
 	Name []byte `gorm:"column:name"`
 }
+
+func TestStoreCheckpoint(t *testing.T) {
+	store := &Store{LocalDb: db.UseInmemDB()}
+	defer tearDownStore(store)
+
+	c, err := store.LoadCheckpoint()
+	if err != nil || c != nil {
+		t.Errorf("LoadCheckpoint on empty store: expected nil, actual: %v, %v", c, err)
+		t.FailNow()
+	}
+
+	saved := Checkpoint{Name: "mysql-bin.000003", Pos: 1024}
+	if err = store.SaveCheckpoint(saved); err != nil {
+		t.Errorf("SaveCheckpoint failed: %v\n", err.Error())
+		t.FailNow()
+	}
+	saved.Pos = 2048
+	if err = store.SaveCheckpoint(saved); err != nil {
+		t.Errorf("SaveCheckpoint failed: %v\n", err.Error())
+		t.FailNow()
+	}
+
+	c, err = store.LoadCheckpoint()
+	if err != nil {
+		t.Errorf("LoadCheckpoint failed: %v\n", err.Error())
+		t.FailNow()
+	}
+	if reflect.DeepEqual(&saved, c) == false {
+		t.Errorf("Difference in saved & loaded checkpoint: \n Expected: %v\n   Actual: %v", saved, c)
+	}
+}
+
+func TestStoreGetBatch(t *testing.T) {
+	store := &Store{LocalDb: db.UseInmemDB()}
+	defer tearDownStore(store)
+
+	for i := 0; i < 5; i++ {
+		if err := store.LogInsert("StoreTest", &storeTest{i, []byte("Name")}); err != nil {
+			t.Errorf("Insert storeTest failed: %v\n", err.Error())
+			t.FailNow()
+		}
+	}
+
+	var ids []int
+	err := store.GetBatch("StoreTest", &storeTest{}, 3, func(rec *Record) error {
+		ids = append(ids, rec.New.(*storeTest).ID)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("GetBatch failed: %v\n", err.Error())
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(ids, []int{0, 1, 2}) {
+		t.Errorf("GetBatch - Expected: [0 1 2], Actual: %v", ids)
+	}
+
+	// remove the first batch, the rest should be returned next
+	if err = store.LRem("StoreTest", len(ids)); err != nil {
+		t.Errorf("LRem failed: %v\n", err.Error())
+		t.FailNow()
+	}
+	ids = nil
+	err = store.GetBatch("StoreTest", &storeTest{}, 3, func(rec *Record) error {
+		ids = append(ids, rec.New.(*storeTest).ID)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("GetBatch failed: %v\n", err.Error())
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(ids, []int{3, 4}) {
+		t.Errorf("GetBatch - Expected: [3 4], Actual: %v", ids)
+	}
+}
+
+func TestStoreJournal(t *testing.T) {
+	store := &Store{
+		LocalDb: db.UseInmemDB(),
+		Models: ModelDefinitions{
+			"StoreTest":  &storeTest{},
+			"SyncerTest": &syncerTest{},
+		},
+	}
+	defer tearDownStore(store)
+	if err := store.EnableJournal(); err != nil {
+		t.Errorf("EnableJournal failed: %v\n", err.Error())
+		t.FailNow()
+	}
+
+	// 1st transaction: interleaved tables
+	store.LogInsert("StoreTest", &storeTest{1, []byte("order")})
+	store.LogInsert("SyncerTest", &syncerTest{ID: 1, Name: "order line"})
+	store.LogUpdate("StoreTest", &storeTest{1, []byte("order")}, &storeTest{1, []byte("order updated")})
+	store.LogCommit()
+	// empty transaction should not log a commit marker
+	store.LogCommit()
+	// 2nd transaction is not committed, simulate a restart of the parser
+	store.LogDelete("StoreTest", &storeTest{1, []byte("order updated")})
+	if err := store.EnableJournal(); err != nil {
+		t.Errorf("EnableJournal failed: %v\n", err.Error())
+		t.FailNow()
+	}
+
+	var actions []Action
+	var tables []string
+	var lastSeq uint64
+	err := store.GetJournal(0, 100, func(rec *Record) error {
+		actions = append(actions, rec.Action)
+		tables = append(tables, rec.Table)
+		if rec.Seq <= lastSeq {
+			t.Errorf("Journal sequence is not monotonic: %d after %d", rec.Seq, lastSeq)
+		}
+		lastSeq = rec.Seq
+		return nil
+	})
+	if err != nil {
+		t.Errorf("GetJournal failed: %v\n", err.Error())
+		t.FailNow()
+	}
+	expectedActions := []Action{InsertAction, InsertAction, UpdateAction, CommitAction, DeleteAction, AbortAction}
+	expectedTables := []string{"StoreTest", "SyncerTest", "StoreTest", "", "StoreTest", ""}
+	if !reflect.DeepEqual(actions, expectedActions) || !reflect.DeepEqual(tables, expectedTables) {
+		t.Errorf("Expected: %v %v\n   Actual: %v %v", expectedActions, expectedTables, actions, tables)
+	}
+
+	store.SkipJournalRecord(2)
+	store.SkipJournalRecord(5)
+	if err = store.TrimJournal(4); err != nil {
+		t.Errorf("TrimJournal failed: %v\n", err.Error())
+		t.FailNow()
+	}
+	if size, _ := store.JournalSize(); size != 2 {
+		t.Errorf("JournalSize - Expected: 2, Actual: %v", size)
+	}
+	// skip marks of trimmed records are removed
+	if skips, _ := store.journalSkips(); !reflect.DeepEqual(skips, map[uint64]bool{5: true}) {
+		t.Errorf("journalSkips - Expected: %v, Actual: %v", map[uint64]bool{5: true}, skips)
+	}
+}
+
+func TestStoreJournalNutsDB(t *testing.T) {
+	store := newNutsStore(t)
+	// the journal list does not exist on first start
+	if err := store.EnableJournal(); err != nil {
+		t.Fatalf("EnableJournal failed: %v", err)
+	}
+	if size, err := store.JournalSize(); err != nil || size != 0 {
+		t.Errorf("JournalSize - Expected: 0, Actual: %v %v", size, err)
+	}
+	if err := store.TrimJournal(1); err != nil {
+		t.Errorf("TrimJournal failed: %v", err)
+	}
+
+	store.LogInsert("StoreTest", &storeTest{1, []byte("order")})
+	store.LogCommit()
+	var actions []Action
+	err := store.GetJournal(0, 100, func(rec *Record) error {
+		actions = append(actions, rec.Action)
+		return nil
+	})
+	if expected := []Action{InsertAction, CommitAction}; err != nil || !reflect.DeepEqual(actions, expected) {
+		t.Errorf("GetJournal - Expected: %v, Actual: %v %v", expected, actions, err)
+	}
+}
+
+func TestStoreSchemaChange(t *testing.T) {
+	store := &Store{LocalDb: db.UseInmemDB()}
+
+	if err := store.Pause("StoreTest", "stale datamodel"); err != nil {
+		t.Errorf("Pause failed: %v\n", err.Error())
+		t.FailNow()
+	}
+	if paused, _ := store.PausedTables(); paused["StoreTest"] != "stale datamodel" {
+		t.Errorf("PausedTables - Expected: %v, Actual: %v", "stale datamodel", paused["StoreTest"])
+	}
+	store.Resume("StoreTest")
+	if paused, _ := store.PausedTables(); len(paused) != 0 {
+		t.Errorf("PausedTables - Expected empty, Actual: %v", paused)
+	}
+
+	if alters, _ := store.GetAlters("StoreTest"); len(alters) != 0 {
+		t.Errorf("GetAlters - Expected empty, Actual: %v", alters)
+	}
+	store.LogAlter("StoreTest", "alter table StoreTest add a bigint null")
+	store.LogAlter("StoreTest", "alter table StoreTest drop column b")
+	store.RemAlters("StoreTest", 1)
+	if alters, _ := store.GetAlters("StoreTest"); !reflect.DeepEqual(alters, []string{"alter table StoreTest drop column b"}) {
+		t.Errorf("GetAlters - Actual: %v", alters)
+	}
+
+	expected := SchemaChange{Table: "StoreTest", Query: "alter table StoreTest drop b", MissingColumns: []string{"b"}, Policy: "pause"}
+	store.LogSchemaChange(expected)
+	changes, err := store.SchemaChanges()
+	if err != nil || len(changes) != 1 || !reflect.DeepEqual(changes[0], expected) {
+		t.Errorf("SchemaChanges - Expected: %v, Actual: %v %v", expected, changes, err)
+	}
+}
+
+func TestStoreSchemaChangeNutsDB(t *testing.T) {
+	store := newNutsStore(t)
+	// nothing recorded yet on a fresh store
+	if changes, err := store.SchemaChanges(); err != nil || len(changes) != 0 {
+		t.Errorf("SchemaChanges - Expected empty, Actual: %v %v", changes, err)
+	}
+	if alters, err := store.GetAlters("StoreTest"); err != nil || len(alters) != 0 {
+		t.Errorf("GetAlters - Expected empty, Actual: %v %v", alters, err)
+	}
+
+	expected := SchemaChange{Table: "StoreTest", Query: "alter table StoreTest drop b", MissingColumns: []string{"b"}, Policy: "pause"}
+	store.LogSchemaChange(expected)
+	changes, err := store.SchemaChanges()
+	if err != nil || len(changes) != 1 || !reflect.DeepEqual(changes[0], expected) {
+		t.Errorf("SchemaChanges - Expected: %v, Actual: %v %v", expected, changes, err)
+	}
+}
+
+func TestStoreDeadLetter(t *testing.T) {
+	store := &Store{LocalDb: db.UseInmemDB()}
+
+	cause := fmt.Errorf("Insert error: %w", mssql.Error{Number: 2628, Message: "String or binary data would be truncated"})
+	if !isRecordError(cause) || isRecordError(fmt.Errorf("connection reset")) {
+		t.Errorf("isRecordError failed to classify errors")
+	}
+	rec := &Record{Action: UpdateAction, Old: &storeTest{1, []byte("old")}, New: &storeTest{1, []byte("new")}}
+	for i := 0; i < 2; i++ {
+		d, err := newDeadLetter("StoreTest", rec, cause)
+		if err != nil {
+			t.Errorf("newDeadLetter failed: %v\n", err.Error())
+			t.FailNow()
+		}
+		store.PutDeadLetter(d)
+	}
+
+	list, err := store.DeadLetters("StoreTest")
+	if err != nil || len(list) != 2 || list[0].ID >= list[1].ID {
+		t.Errorf("DeadLetters - Expected 2 ordered dead letters, Actual: %v %v", list, err)
+		t.FailNow()
+	}
+	d, _ := store.DeadLetter("StoreTest", list[0].ID)
+	if d == nil || d.Error != cause.Error() || d.Attempts != 1 {
+		t.Errorf("DeadLetter - Actual: %v", d)
+		t.FailNow()
+	}
+	actual, err := d.record(&storeTest{})
+	if err != nil || !reflect.DeepEqual(actual.Old, rec.Old) || !reflect.DeepEqual(actual.New, rec.New) {
+		t.Errorf("record - Expected: %v %v, Actual: %v %v %v", rec.Old, rec.New, actual.Old, actual.New, err)
+	}
+
+	store.DeleteDeadLetter("StoreTest", list[0].ID)
+	if list, _ = store.DeadLetters("StoreTest"); len(list) != 1 {
+		t.Errorf("DeleteDeadLetter - Expected 1 dead letter, Actual: %v", len(list))
+	}
+}
+
+func TestStoreTableStatus(t *testing.T) {
+	store := &Store{LocalDb: db.UseInmemDB(), Models: ModelDefinitions{"StoreTest": &storeTest{}, "SyncerTest": &storeTest{}}}
+
+	if tables := store.Tables(); !reflect.DeepEqual(tables, []string{"StoreTest", "SyncerTest"}) {
+		t.Errorf("Tables - Actual: %v", tables)
+	}
+	for i := 0; i < 3; i++ {
+		store.LogInsert("StoreTest", &storeTest{i, []byte("Name")})
+	}
+	d, _ := newDeadLetter("StoreTest", &Record{Action: InsertAction, New: &storeTest{3, []byte("Name")}}, fmt.Errorf("Insert error"))
+	store.PutDeadLetter(d)
+	store.Pause("StoreTest", "stale datamodel")
+
+	expected := TableStatus{Pending: 3, DeadLetters: 1, Paused: "stale datamodel"}
+	if actual, err := store.TableStatus("StoreTest"); err != nil || actual != expected {
+		t.Errorf("TableStatus - Expected: %v, Actual: %v %v", expected, actual, err)
+	}
+	if actual, err := store.TableStatus("SyncerTest"); err != nil || actual != (TableStatus{}) {
+		t.Errorf("TableStatus - Expected empty, Actual: %v %v", actual, err)
+	}
+}
+
+func TestStorePendingMetric(t *testing.T) {
+	store := &Store{LocalDb: db.UseInmemDB()}
+	for i := 0; i < 3; i++ {
+		store.LogInsert("StoreTest", &storeTest{i, []byte("Name")})
+	}
+	store.LRem("StoreTest", 1)
+	if actual := testutil.ToFloat64(metrics.PendingRecords.WithLabelValues("StoreTest")); actual != 2 {
+		t.Errorf("PendingRecords - Expected: 2, Actual: %v", actual)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	mssql "github.com/denisenkom/go-mssqldb" //driver for MSSQL, to work with "database/sql" package
 )
@@ -17,33 +19,94 @@ type TargetDbConfig struct {
 	Log      uint8
 	Encrypt  string
 	Appname  string
+	// BatchSize is the max number of records per table applied in one transaction during a sync pass, default 1000
+	BatchSize int
+	// ApplyMode decides how logged records are written to target tables, default PlainMode
+	ApplyMode ApplyMode
+	// MaxRetries is the max number of retries of a sync failed on transient errors (deadlocks, connection loss...),
+	// default 5, negative value disables retrying
+	MaxRetries int
+	// RetryInterval is the wait before the first retry, doubled on each retry up to MaxRetryInterval; default 1s & 1m
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// RetryJitter randomizes each wait by up to ±RetryJitter of it (0 to 1), default 0.2, negative value disables it
+	RetryJitter float64
 }
 
+const defaultBatchSize = 1000
+
+// ApplyMode decides how logged records are written to target tables
+type ApplyMode string
+
+const (
+	// PlainMode writes inserts as `insert into`, replaying a logged insert fails on primary key violation
+	PlainMode ApplyMode = "plain"
+	// UpsertMode writes inserts & updates as `merge` keyed on primary key columns, replays are always safe
+	UpsertMode ApplyMode = "upsert"
+)
+
 // Syncer wrapper, uses go-mssqldb underneath
 type Syncer struct {
-	store          *Store
-	interval       int64
-	cfg            TargetDbConfig
-	db             *sql.DB
-	insertStmts    map[string]*sql.Stmt
-	updateStmts    map[string]*sql.Stmt
-	deleteStmts    map[string]*sql.Stmt
+	store       *Store
+	interval    int64
+	cfg         TargetDbConfig
+	db          *sql.DB
+	insertStmts map[string]*sql.Stmt
+	updateStmts map[string]*sql.Stmt
+	deleteStmts map[string]*sql.Stmt
+	mergeStmts  map[string]*sql.Stmt
+	// models which cached statements are built from
+	models map[string]interface{}
+	// serializes sync passes & dead letter retries, which share the cached statements
+	mu             *sync.Mutex
 	syncQuitSignal chan struct{}
+	// same channel as syncQuitSignal, but kept by the scheduled job after `Stop`
+	jobQuitSignal chan struct{}
+	// see `Status`
+	statusMu sync.Mutex
+	status   Status
 }
 
 // Insert a single row to `targetTable`
 func (s *Syncer) Insert(targetTable string, model interface{}) (sql.Result, error) {
+	return s.insert(nil, targetTable, model)
+}
+
+func (s *Syncer) insert(tx *sql.Tx, targetTable string, model interface{}) (sql.Result, error) {
 	cols, newVals := getColumns(model, false)
 
 	if s.insertStmts[targetTable] == nil {
-		stmt, err := s.db.Prepare(buildInsertStatement(targetTable, cols))
+		stmt, err := s.db.Prepare(buildInsertStatement(s.target(targetTable), cols))
 		if err != nil {
 			return nil, err
 		}
 		s.insertStmts[targetTable] = stmt
 	}
 
-	return s.insertStmts[targetTable].Exec(newVals...)
+	return exec(tx, s.insertStmts[targetTable], newVals...)
+}
+
+// Upsert a single row to `targetTable` based on `primaryKey` tag defined on model struct,
+// the row is updated if the primary key exists, inserted otherwise
+func (s *Syncer) Upsert(targetTable string, model interface{}) (sql.Result, error) {
+	return s.upsert(nil, targetTable, model)
+}
+
+func (s *Syncer) upsert(tx *sql.Tx, targetTable string, model interface{}) (sql.Result, error) {
+	cols, newVals := getColumns(model, false)
+
+	if s.mergeStmts[targetTable] == nil {
+		if !hasPrimaryKey(cols) {
+			return nil, fmt.Errorf("primaryKey tag not defined in model of %v", targetTable)
+		}
+		stmt, err := s.db.Prepare(buildMergeStatement(s.target(targetTable), cols))
+		if err != nil {
+			return nil, err
+		}
+		s.mergeStmts[targetTable] = stmt
+	}
+
+	return exec(tx, s.mergeStmts[targetTable], newVals...)
 }
 
 // Update a single row to `targetTable`.
@@ -55,7 +118,7 @@ func (s *Syncer) Update(targetTable string, model interface{}, where string, con
 	cols, newVals := getColumns(model, false)
 
 	if s.updateStmts[targetTable] == nil {
-		stmt, err := s.db.Prepare(buildUpdateStatement(targetTable, cols, where))
+		stmt, err := s.db.Prepare(buildUpdateStatement(s.target(targetTable), cols, where))
 		if err != nil {
 			return nil, err
 		}
@@ -70,12 +133,16 @@ func (s *Syncer) Update(targetTable string, model interface{}, where string, con
 // Example:
 // 	UpdateOnPK("table_name", oldModel, newModel)
 func (s *Syncer) UpdateOnPK(targetTable string, oldModel interface{}, newModel interface{}) (sql.Result, error) {
+	return s.updateOnPK(nil, targetTable, oldModel, newModel)
+}
+
+func (s *Syncer) updateOnPK(tx *sql.Tx, targetTable string, oldModel interface{}, newModel interface{}) (sql.Result, error) {
 	cols, newVals := getColumns(newModel, false)
 
 	if s.updateStmts[targetTable] == nil {
 		// since data structure of oldModel & newModel is the same
 		// so the result of `buildUpdateStatement` is indifferent of the new or old model we pass in
-		stmt, err := s.db.Prepare(buildUpdateStatement(targetTable, cols, ""))
+		stmt, err := s.db.Prepare(buildUpdateStatement(s.target(targetTable), cols, ""))
 		if err != nil {
 			return nil, err
 		}
@@ -88,7 +155,7 @@ func (s *Syncer) UpdateOnPK(targetTable string, oldModel interface{}, newModel i
 		return nil, fmt.Errorf("primaryKey tag not defined in model of %v", targetTable)
 	}
 
-	return s.updateStmts[targetTable].Exec(append(newVals, pks...)...)
+	return exec(tx, s.updateStmts[targetTable], append(newVals, pks...)...)
 }
 
 // Delete a single row from `targetTable`.
@@ -98,7 +165,7 @@ func (s *Syncer) UpdateOnPK(targetTable string, oldModel interface{}, newModel i
 // 	Delete("table_name", "id = ? AND name = ?", 1, "username")
 func (s *Syncer) Delete(targetTable string, where string, conditions ...interface{}) (sql.Result, error) {
 	if s.deleteStmts[targetTable] == nil {
-		stmt, err := s.db.Prepare(buildDeleteStatement(targetTable, where))
+		stmt, err := s.db.Prepare(buildDeleteStatement(s.target(targetTable), where))
 		if err != nil {
 			return nil, err
 		}
@@ -111,29 +178,96 @@ func (s *Syncer) Delete(targetTable string, where string, conditions ...interfac
 // Example:
 // 	DeleteOnPK("table_name", model)
 func (s *Syncer) DeleteOnPK(targetTable string, model interface{}) (sql.Result, error) {
+	return s.deleteOnPK(nil, targetTable, model)
+}
+
+func (s *Syncer) deleteOnPK(tx *sql.Tx, targetTable string, model interface{}) (sql.Result, error) {
 	cols, pks := getColumns(model, true)
 	if len(pks) == 0 {
 		return nil, fmt.Errorf("primaryKey tag not defined in model of %v", targetTable)
 	}
 
 	if s.deleteStmts[targetTable] == nil {
-		stmt, err := s.db.Prepare(buildDeleteStatementFromPK(targetTable, cols))
+		stmt, err := s.db.Prepare(buildDeleteStatementFromPK(s.target(targetTable), cols))
 		if err != nil {
 			return nil, err
 		}
 		s.deleteStmts[targetTable] = stmt
 	}
-	return s.deleteStmts[targetTable].Exec(pks...)
+	return exec(tx, s.deleteStmts[targetTable], pks...)
+}
+
+// CreateTable creates `targetTable` from the column definitions of model struct if it does not exist yet,
+// see `BuildCreateTableStatement` for the column type mapping
+func (s *Syncer) CreateTable(targetTable string, model interface{}) error {
+	cols, _ := getColumns(model, false)
+	target := s.target(targetTable)
+	_, err := s.db.Exec(fmt.Sprintf("if object_id(N'%s', N'U') is null %s",
+		strings.Replace(quoteTable(target), "'", "''", -1), buildCreateTableStatement(target, cols)))
+	return err
+}
+
+// CreateTables calls `CreateTable` for every model in store
+func (s *Syncer) CreateTables() error {
+	for table, model := range s.store.models() {
+		if err := s.CreateTable(table, model); err != nil {
+			return fmt.Errorf("create table %v error: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// BuildCreateTableStatement renders the T-SQL `create table` statement of `targetTable` from model struct,
+// pointer fields are nullable & `primaryKey` tagged columns make up the primary key constraint
+func BuildCreateTableStatement(targetTable string, model interface{}) string {
+	cols, _ := getColumns(model, false)
+	return buildCreateTableStatement(targetTable, cols)
+}
+
+// BuildAlterTableStatements renders the T-SQL statements altering `targetTable` from the columns of `oldModel`
+// to the columns of `newModel`: columns only in `newModel` are added (always nullable, since the table may have rows),
+// columns only in `oldModel` are dropped
+func BuildAlterTableStatements(targetTable string, oldModel interface{}, newModel interface{}) (stmts []string) {
+	oldCols, _ := getColumns(oldModel, false)
+	newCols, _ := getColumns(newModel, false)
+	old := make(map[string]bool, len(oldCols))
+	for _, c := range oldCols {
+		old[c.name] = true
+	}
+	for _, c := range newCols {
+		if !old[c.name] {
+			stmts = append(stmts, fmt.Sprintf("alter table %s add %s %s null", quoteTable(targetTable), quoteName(c.name), sqlServerType(c)))
+		}
+		delete(old, c.name)
+	}
+	for _, c := range oldCols {
+		if old[c.name] {
+			stmts = append(stmts, fmt.Sprintf("alter table %s drop column %s", quoteTable(targetTable), quoteName(c.name)))
+		}
+	}
+	return
 }
 
 // Close connection pool
 func (s *Syncer) Close() {
-	for _, stmts := range s.insertStmts {
-		stmts.Close()
+	for _, stmts := range []map[string]*sql.Stmt{s.insertStmts, s.updateStmts, s.deleteStmts, s.mergeStmts} {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
 	}
 	s.db.Close()
 }
 
+// resetStatements closes the cached statements of `targetTable`, they're prepared again on next use
+func (s *Syncer) resetStatements(targetTable string) {
+	for _, stmts := range []map[string]*sql.Stmt{s.insertStmts, s.updateStmts, s.deleteStmts, s.mergeStmts} {
+		if stmt := stmts[targetTable]; stmt != nil {
+			stmt.Close()
+			delete(stmts, targetTable)
+		}
+	}
+}
+
 // SetLogger set custom logger for database driver
 func (s *Syncer) SetLogger(logger interface{}) {
 	mssql.SetLogger(logger.(mssql.Logger))
@@ -142,6 +276,23 @@ func (s *Syncer) SetLogger(logger interface{}) {
 // NewSyncer returns new instance of Syncer, should be called only once.
 // intv is the interval frequency (second) between each log store scan
 func NewSyncer(cfg TargetDbConfig, intv int64, s *Store) *Syncer {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	if cfg.MaxRetryInterval <= 0 {
+		cfg.MaxRetryInterval = defaultMaxRetryInterval
+	}
+	if cfg.RetryJitter == 0 {
+		cfg.RetryJitter = defaultRetryJitter
+	} else if cfg.RetryJitter < 0 {
+		cfg.RetryJitter = 0
+	}
 	conn := buildConn(cfg)
 	return &Syncer{
 		store:       s,
@@ -151,11 +302,22 @@ func NewSyncer(cfg TargetDbConfig, intv int64, s *Store) *Syncer {
 		insertStmts: make(map[string]*sql.Stmt, 0),
 		updateStmts: make(map[string]*sql.Stmt, 0),
 		deleteStmts: make(map[string]*sql.Stmt, 0),
+		mergeStmts:  make(map[string]*sql.Stmt, 0),
+		models:      make(map[string]interface{}, 0),
+		mu:          &sync.Mutex{},
 	}
 }
 
 ///////////////////////////////private methods////////////////////////////////
 
+// exec runs prepared statement `stmt` inside transaction `tx`, or directly if `tx` is nil
+func exec(tx *sql.Tx, stmt *sql.Stmt, args ...interface{}) (sql.Result, error) {
+	if tx != nil {
+		return tx.Stmt(stmt).Exec(args...)
+	}
+	return stmt.Exec(args...)
+}
+
 func buildConn(cfg TargetDbConfig) (conn *sql.DB) {
 	var connectStringBuilder strings.Builder
 	connectStringBuilder.Grow(50)
@@ -183,8 +345,67 @@ func buildConn(cfg TargetDbConfig) (conn *sql.DB) {
 	return
 }
 
+// target returns the name of the table in target db which `table` is synced to, see `Store.SetTarget`
+func (s *Syncer) target(table string) string {
+	if s.store == nil {
+		return table
+	}
+	return s.store.Target(table)
+}
+
+// TableName returns the quoted name of `table` in `schema`, or in the default schema of the login if `schema` is empty
+func TableName(schema string, table string) string {
+	if schema == "" {
+		return quoteName(table)
+	}
+	return quoteName(schema) + "." + quoteName(table)
+}
+
+// quoteName quotes an identifier with [], closing brackets inside are escaped
+func quoteName(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+// quoteTable quotes each part of a table name which may be schema-qualified,
+// parts already quoted with [] are kept as is.
+// Example:
+//
+//	quoteTable("staging.tbl_Staff") => "[staging].[tbl_Staff]"
+func quoteTable(table string) string {
+	parts := splitTableName(table)
+	for i, part := range parts {
+		parts[i] = quoteName(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// splitTableName splits a table name which may be schema-qualified into unquoted parts
+func splitTableName(table string) (parts []string) {
+	var part strings.Builder
+	quoted := false
+	for i := 0; i < len(table); i++ {
+		switch ch := table[i]; {
+		case quoted && ch == ']':
+			if i+1 < len(table) && table[i+1] == ']' { // escaped closing bracket
+				part.WriteByte(ch)
+				i++
+			} else {
+				quoted = false
+			}
+		case !quoted && ch == '[':
+			quoted = true
+		case !quoted && ch == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(ch)
+		}
+	}
+	return append(parts, part.String())
+}
+
 func (s *Syncer) truncate(targetTable string) (sql.Result, error) {
-	return s.db.Exec(fmt.Sprintf("truncate table %s", targetTable))
+	return s.db.Exec(fmt.Sprintf("truncate table %s", quoteTable(s.target(targetTable))))
 }
 
 func buildInsertStatement(targetTable string, columns []column) string {
@@ -192,9 +413,9 @@ func buildInsertStatement(targetTable string, columns []column) string {
 	var sBuilder strings.Builder
 	sBuilder.Grow(length * 10)
 
-	fmt.Fprintf(&sBuilder, "insert into %s (", targetTable)
+	fmt.Fprintf(&sBuilder, "insert into %s (", quoteTable(targetTable))
 	for i, c := range columns {
-		fmt.Fprint(&sBuilder, c.name)
+		fmt.Fprint(&sBuilder, quoteName(c.name))
 		if i < length-1 {
 			sBuilder.WriteByte(44) // append comma ","
 		} else {
@@ -204,35 +425,183 @@ func buildInsertStatement(targetTable string, columns []column) string {
 
 	sBuilder.WriteString(" values (")
 	for i, c := range columns {
-		if c.fieldType == "*[]uint8" {
-			// https://github.com/denisenkom/go-mssqldb/issues/530
-			fmt.Fprint(&sBuilder, "CONVERT(VARBINARY(MAX),?)")
+		fmt.Fprint(&sBuilder, placeholder(c))
+		if i < length-1 {
+			sBuilder.WriteByte(44) // append comma ","
 		} else {
-			fmt.Fprint(&sBuilder, "?")
+			sBuilder.WriteByte(41) // append closing bracket ")"
 		}
+	}
+
+	return sBuilder.String()
+}
+
+// placeholder returns the expression of the parameter(s) of column `c` in insert, merge & update statements
+func placeholder(c column) string {
+	switch c.fieldType {
+	case "*[]uint8":
+		// https://github.com/denisenkom/go-mssqldb/issues/530
+		return "CONVERT(VARBINARY(MAX),?)"
+	case "spatial.Geometry", "*spatial.Geometry":
+		// WKB & SRID, see `getColumns`
+		return "geometry::STGeomFromWKB(CONVERT(VARBINARY(MAX),?),?)"
+	case "spatial.Geography", "*spatial.Geography":
+		return "geography::STGeomFromWKB(CONVERT(VARBINARY(MAX),?),?)"
+	}
+	return "?"
+}
+
+// buildMergeStatement builds a `merge` statement that updates the row matching primary key columns, or inserts it if not found
+func buildMergeStatement(targetTable string, columns []column) string {
+	length := len(columns)
+	var sBuilder strings.Builder
+	sBuilder.Grow(length * 40)
+
+	fmt.Fprintf(&sBuilder, "merge into %s with (holdlock) as t using (select ", quoteTable(targetTable))
+	for i, c := range columns {
+		fmt.Fprintf(&sBuilder, "%s as %s", placeholder(c), quoteName(c.name))
 		if i < length-1 {
 			sBuilder.WriteByte(44) // append comma ","
+		}
+	}
+
+	sBuilder.WriteString(") as s on ")
+	var on, set []string
+	for _, c := range columns {
+		name := quoteName(c.name)
+		if c.isPrimaryKey {
+			on = append(on, fmt.Sprintf("t.%s=s.%s", name, name))
 		} else {
-			sBuilder.WriteByte(41) // append closing bracket ")"
+			set = append(set, fmt.Sprintf("%s=s.%s", name, name))
 		}
 	}
+	sBuilder.WriteString(strings.Join(on, " AND "))
+
+	if len(set) > 0 {
+		fmt.Fprintf(&sBuilder, " when matched then update set %s", strings.Join(set, ","))
+	}
+
+	sBuilder.WriteString(" when not matched then insert (")
+	for i, c := range columns {
+		fmt.Fprint(&sBuilder, quoteName(c.name))
+		if i < length-1 {
+			sBuilder.WriteByte(44) // append comma ","
+		}
+	}
+	sBuilder.WriteString(") values (")
+	for i, c := range columns {
+		fmt.Fprintf(&sBuilder, "s.%s", quoteName(c.name))
+		if i < length-1 {
+			sBuilder.WriteByte(44) // append comma ","
+		}
+	}
+	sBuilder.WriteString(");")
 
 	return sBuilder.String()
 }
 
+func buildCreateTableStatement(targetTable string, columns []column) string {
+	length := len(columns)
+	var sBuilder strings.Builder
+	sBuilder.Grow(length * 30)
+
+	fmt.Fprintf(&sBuilder, "create table %s (", quoteTable(targetTable))
+	var pks []string
+	for i, c := range columns {
+		nullable := " not null"
+		if strings.HasPrefix(c.fieldType, "*") {
+			nullable = " null"
+		}
+		fmt.Fprintf(&sBuilder, "%s %s%s", quoteName(c.name), sqlServerType(c), nullable)
+		if i < length-1 {
+			sBuilder.WriteByte(44) // append comma ","
+		}
+		if c.isPrimaryKey {
+			pks = append(pks, quoteName(c.name))
+		}
+	}
+	if len(pks) > 0 {
+		parts := splitTableName(targetTable)
+		fmt.Fprintf(&sBuilder, ",constraint %s primary key (%s)", quoteName("PK_"+parts[len(parts)-1]), strings.Join(pks, ","))
+	}
+	sBuilder.WriteString(");")
+
+	return sBuilder.String()
+}
+
+// sqlServerType returns the SQL Server column type able to hold values of column's Go type
+func sqlServerType(c column) string {
+	switch strings.TrimPrefix(c.fieldType, "*") {
+	case "int":
+		return "bigint"
+	case "uint":
+		// values overflowing bigint are converted to decimal, see `getColumns`
+		return "decimal(21,0)"
+	case "uint8":
+		return "tinyint"
+	case "uint16":
+		return "int"
+	case "uint32":
+		return "bigint"
+	case "uint64":
+		// values overflowing bigint are converted to decimal, see `getColumns`
+		return "decimal(20,0)"
+	case "int16":
+		// YEAR
+		return "smallint"
+	case "int64":
+		// BIT(n), the bits of bit(64) are kept in a negative bigint
+		return "bigint"
+	case "bool":
+		return "bit"
+	case "time.Time":
+		return "datetime2"
+	case "time.Duration":
+		// TIME, as text out of the range of time, see `timeText`
+		return "varchar(17)"
+	case "float32":
+		return "real"
+	case "float64":
+		return "float"
+	case "decimal.Decimal":
+		return "decimal(38,5)"
+	case rawMessageType:
+		// JSON text, see `jsonText`
+		return "nvarchar(max)"
+	case "spatial.Geometry":
+		return "geometry"
+	case "spatial.Geography":
+		return "geography"
+	case "[]uint8":
+		if c.isPrimaryKey {
+			return "varbinary(900)" // max size of an index key
+		}
+		return "varbinary(max)"
+	default:
+		if c.isPrimaryKey {
+			return "nvarchar(450)" // max size of an index key
+		}
+		return "nvarchar(max)"
+	}
+}
+
+func hasPrimaryKey(columns []column) bool {
+	for _, c := range columns {
+		if c.isPrimaryKey {
+			return true
+		}
+	}
+	return false
+}
+
 func buildUpdateStatement(targetTable string, columns []column, where string) string {
 	length := len(columns)
 	var sBuilder strings.Builder
 	sBuilder.Grow(length * 20)
 
-	fmt.Fprintf(&sBuilder, "update %s set ", targetTable)
+	fmt.Fprintf(&sBuilder, "update %s set ", quoteTable(targetTable))
 	for i, c := range columns {
-		if c.fieldType == "*[]uint8" {
-			// https://github.com/denisenkom/go-mssqldb/issues/530
-			fmt.Fprintf(&sBuilder, "%s=CONVERT(VARBINARY(MAX),?)", c.name)
-		} else {
-			fmt.Fprintf(&sBuilder, "%s=?", c.name)
-		}
+		fmt.Fprintf(&sBuilder, "%s=%s", quoteName(c.name), placeholder(c))
 		if i < length-1 {
 			sBuilder.WriteByte(44) // append comma ","
 		}
@@ -244,19 +613,19 @@ func buildUpdateStatement(targetTable string, columns []column, where string) st
 		fmt.Fprintf(&sBuilder, " where %s", where)
 		for _, c := range columns {
 			if c.isPrimaryKey {
-				fmt.Fprintf(&sBuilder, "%s=? AND ", c.name)
+				fmt.Fprintf(&sBuilder, "%s=? AND ", quoteName(c.name))
 			}
 		}
 	}
 
-	return strings.TrimRight(sBuilder.String(), " AND ")
+	return strings.TrimSuffix(sBuilder.String(), " AND ")
 }
 
 func buildDeleteStatement(targetTable string, where string) string {
 	var sBuilder strings.Builder
 	sBuilder.Grow(13 + len(targetTable) + len(where))
 
-	fmt.Fprintf(&sBuilder, "delete from %s", targetTable)
+	fmt.Fprintf(&sBuilder, "delete from %s", quoteTable(targetTable))
 	if where != "" {
 		fmt.Fprintf(&sBuilder, " where %s", where)
 	}
@@ -268,15 +637,15 @@ func buildDeleteStatementFromPK(targetTable string, columns []column) string {
 	var sBuilder strings.Builder
 	sBuilder.Grow(13 + len(targetTable) + 30)
 
-	fmt.Fprintf(&sBuilder, "delete from %s", targetTable)
+	fmt.Fprintf(&sBuilder, "delete from %s", quoteTable(targetTable))
 	if len(columns) > 0 {
 		fmt.Fprint(&sBuilder, " where ")
 		for _, c := range columns {
 			if c.isPrimaryKey {
-				fmt.Fprintf(&sBuilder, "%s=? AND ", c.name)
+				fmt.Fprintf(&sBuilder, "%s=? AND ", quoteName(c.name))
 			}
 		}
 	}
 
-	return strings.TrimRight(sBuilder.String(), " AND ")
+	return strings.TrimSuffix(sBuilder.String(), " AND ")
 }
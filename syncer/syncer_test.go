@@ -1,10 +1,17 @@
 package syncer
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"mysql2mssql/db"
+	"mysql2mssql/spatial"
 	"reflect"
 	"testing"
 	"time"
 
+	mssql "github.com/denisenkom/go-mssqldb"
 	dcm "github.com/shopspring/decimal"
 )
 
@@ -85,8 +92,8 @@ func TestGenerateInsertStatement(t *testing.T) {
 	}
 	cols, _ := getColumns(model, false)
 	upt := buildInsertStatement("testtable", cols)
-	if upt != "insert into testtable (id,name,bo,bi,bi_u,de,fl,do,bit,dtime,date,time,blb,bnr) values (?,?,?,?,?,?,?,?,?,?,?,?,?,CONVERT(VARBINARY(MAX),?))" {
-		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", "insert into testtable (id,name,bo,bi,bi_u,de,fl,do,bit,dtime,date,time,blb,bnr) values (?,?,?,?,?,?,?,?,?,?,?,?,?,CONVERT(VARBINARY(MAX),?))", upt)
+	if upt != "insert into [testtable] ([id],[name],[bo],[bi],[bi_u],[de],[fl],[do],[bit],[dtime],[date],[time],[blb],[bnr]) values (?,?,?,?,?,?,?,?,?,?,?,?,?,CONVERT(VARBINARY(MAX),?))" {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", "insert into [testtable] ([id],[name],[bo],[bi],[bi_u],[de],[fl],[do],[bit],[dtime],[date],[time],[blb],[bnr]) values (?,?,?,?,?,?,?,?,?,?,?,?,?,CONVERT(VARBINARY(MAX),?))", upt)
 	}
 }
 
@@ -96,7 +103,7 @@ func TestGenerateUpdateStatement(t *testing.T) {
 		Name: "中文 English Tiếng Việt",
 	}
 	cols, _ := getColumns(model, false)
-	expected := "update testtable set id=?,name=?,bo=?,bi=?,bi_u=?,de=?,fl=?,do=?,bit=?,dtime=?,date=?,time=?,blb=?,bnr=CONVERT(VARBINARY(MAX),?) where id = 1"
+	expected := "update [testtable] set [id]=?,[name]=?,[bo]=?,[bi]=?,[bi_u]=?,[de]=?,[fl]=?,[do]=?,[bit]=?,[dtime]=?,[date]=?,[time]=?,[blb]=?,[bnr]=CONVERT(VARBINARY(MAX),?) where id = 1"
 	actual := buildUpdateStatement("testtable", cols, "id = 1")
 	if actual != expected {
 		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
@@ -111,13 +118,291 @@ func TestGenerateUpdateStatementUsingPK(t *testing.T) {
 		BiU:  nil,
 	}
 	cols, _ := getColumns(model, false)
-	expected := "update testtable set id=?,name=?,bo=?,bi=?,bi_u=?,de=?,fl=?,do=?,bit=?,dtime=?,date=?,time=?,blb=?,bnr=CONVERT(VARBINARY(MAX),?) where id=? AND name=?"
+	expected := "update [testtable] set [id]=?,[name]=?,[bo]=?,[bi]=?,[bi_u]=?,[de]=?,[fl]=?,[do]=?,[bit]=?,[dtime]=?,[date]=?,[time]=?,[blb]=?,[bnr]=CONVERT(VARBINARY(MAX),?) where [id]=? AND [name]=?"
 	actual := buildUpdateStatement("testtable", cols, "") // set 'where' empty
 	if actual != expected {
 		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
 	}
 }
 
+func TestGenerateMergeStatement(t *testing.T) {
+	model := &storeTest{
+		ID:   1,
+		Name: []byte("name"),
+	}
+	cols, _ := getColumns(model, false)
+	expected := "merge into [testtable] with (holdlock) as t using (select ? as [id],? as [name]) as s on t.[id]=s.[id] when matched then update set [name]=s.[name] when not matched then insert ([id],[name]) values (s.[id],s.[name]);"
+	actual := buildMergeStatement("testtable", cols)
+	if actual != expected {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
+	}
+}
+
+func TestGenerateCreateTableStatement(t *testing.T) {
+	expected := "create table [testtable] ([id] bigint not null,[name] nvarchar(450) not null,[bo] bit not null,[bi] bigint not null," +
+		"[bi_u] decimal(21,0) null,[de] decimal(38,5) not null,[fl] real not null,[do] float not null,[bit] bigint not null," +
+		"[dtime] datetime2 not null,[date] datetime2 null,[time] nvarchar(max) null,[blb] varbinary(max) not null,[bnr] varbinary(max) null," +
+		"constraint [PK_testtable] primary key ([id],[name]));"
+	actual := BuildCreateTableStatement("testtable", &syncerTest{})
+	if actual != expected {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
+	}
+}
+
+func TestGenerateAlterTableStatements(t *testing.T) {
+	oldModel := &struct {
+		ID      int    `gorm:"column:id;primaryKey"`
+		Name    string `gorm:"column:name"`
+		Dropped string `gorm:"column:dropped"`
+	}{}
+	newModel := &struct {
+		ID    int        `gorm:"column:id;primaryKey"`
+		Name  string     `gorm:"column:name"`
+		Added *time.Time `gorm:"column:added"`
+	}{}
+	expected := []string{
+		"alter table [testtable] add [added] datetime2 null",
+		"alter table [testtable] drop column [dropped]",
+	}
+	actual := BuildAlterTableStatements("testtable", oldModel, newModel)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected: \n\n%v\n\n Actual: \n\n%v\n\n", expected, actual)
+	}
+}
+
+func TestGenerateStatementsWithTargetNames(t *testing.T) {
+	model := &struct {
+		ID   int    `gorm:"column:staff_id;primaryKey" target:"StaffID"`
+		Name string `gorm:"column:first_name" target:"FirstName"`
+	}{}
+	cols, _ := getColumns(model, false)
+	target := TableName("staging", "tbl_Staff")
+	expected := []string{
+		"insert into [staging].[tbl_Staff] ([StaffID],[FirstName]) values (?,?)",
+		"update [staging].[tbl_Staff] set [StaffID]=?,[FirstName]=? where [StaffID]=?",
+		"delete from [staging].[tbl_Staff] where [StaffID]=?",
+		"create table [staging].[tbl_Staff] ([StaffID] bigint not null,[FirstName] nvarchar(max) not null,constraint [PK_tbl_Staff] primary key ([StaffID]));",
+	}
+	actual := []string{
+		buildInsertStatement(target, cols),
+		buildUpdateStatement(target, cols, ""),
+		buildDeleteStatementFromPK(target, cols),
+		buildCreateTableStatement(target, cols),
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected: \n\n%v\n\n Actual: \n\n%v\n\n", expected, actual)
+	}
+
+	names := map[string]string{
+		"staff":             "[staff]",
+		"staging.tbl_Staff": "[staging].[tbl_Staff]",
+		"[dbo].[a.b]":       "[dbo].[a.b]",
+		"[we]]ird]":         "[we]]ird]",
+	}
+	for name, quoted := range names {
+		if actual := quoteTable(name); actual != quoted {
+			t.Errorf("%v: expected %v, actual %v", name, quoted, actual)
+		}
+	}
+}
+
+func TestTimeYearBitColumns(t *testing.T) {
+	d := 25 * time.Hour
+	model := &struct {
+		ID    int            `gorm:"column:id;primaryKey"`
+		Time  time.Duration  `gorm:"column:time"`
+		NTime *time.Duration `gorm:"column:ntime"`
+		Neg   time.Duration  `gorm:"column:neg"`
+		Year  int16          `gorm:"column:year"`
+		Bit   *int64         `gorm:"column:bit"`
+	}{Time: 13*time.Hour + 30*time.Minute + time.Microsecond, NTime: &d, Neg: -(838*time.Hour + 59*time.Minute + 59*time.Second), Year: 2021}
+
+	cols, values := getColumns(model, false)
+	expected := "create table [testtable] ([id] bigint not null,[time] varchar(17) not null,[ntime] varchar(17) null," +
+		"[neg] varchar(17) not null,[year] smallint not null,[bit] bigint null,constraint [PK_testtable] primary key ([id]));"
+	if actual := buildCreateTableStatement("testtable", cols); actual != expected {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
+	}
+
+	// values out of the range of a time of day are synced too
+	for i, expected := range map[int]string{1: "13:30:00.000001", 2: "25:00:00.000000", 3: "-838:59:59.000000"} {
+		if values[i] != expected {
+			t.Errorf("Expected TIME %v, Actual: %v", expected, values[i])
+		}
+	}
+	if values[4] != int16(2021) || values[5] != nil {
+		t.Errorf("Expected year 2021 & NULL bit, Actual: %v %v", values[4], values[5])
+	}
+}
+
+func TestJSONColumns(t *testing.T) {
+	doc := json.RawMessage(`{"a":[1,2]}`)
+	model := &struct {
+		ID    int              `gorm:"column:id;primaryKey"`
+		Doc   json.RawMessage  `gorm:"column:doc"`
+		NDoc  *json.RawMessage `gorm:"column:ndoc"`
+		Empty json.RawMessage  `gorm:"column:empty"`
+	}{Doc: doc, NDoc: &doc}
+
+	cols, values := getColumns(model, false)
+	expected := "create table [testtable] ([id] bigint not null,[doc] nvarchar(max) not null,[ndoc] nvarchar(max) null," +
+		"[empty] nvarchar(max) not null,constraint [PK_testtable] primary key ([id]));"
+	if actual := buildCreateTableStatement("testtable", cols); actual != expected {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
+	}
+	if values[1] != `{"a":[1,2]}` || values[2] != `{"a":[1,2]}` || values[3] != "null" {
+		t.Errorf("Expected JSON text, Actual: %#v %#v %#v", values[1], values[2], values[3])
+	}
+}
+
+func TestSpatialColumns(t *testing.T) {
+	wkb := []byte{1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 240, 63, 0, 0, 0, 0, 0, 0, 0, 64} // POINT(1 2)
+	model := &struct {
+		ID       int                `gorm:"column:id;primaryKey"`
+		Location spatial.Geography  `gorm:"column:location"`
+		Shape    *spatial.Geometry  `gorm:"column:shape"`
+		Area     *spatial.Geography `gorm:"column:area"`
+	}{ID: 1, Location: spatial.Geography{WKB: wkb}, Shape: &spatial.Geometry{SRID: 3857, WKB: wkb}}
+
+	cols, values := getColumns(model, false)
+	expected := "create table [testtable] ([id] bigint not null,[location] geography not null,[shape] geometry null," +
+		"[area] geography null,constraint [PK_testtable] primary key ([id]));"
+	if actual := buildCreateTableStatement("testtable", cols); actual != expected {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
+	}
+	expected = "insert into [testtable] ([id],[location],[shape],[area]) values (?," +
+		"geography::STGeomFromWKB(CONVERT(VARBINARY(MAX),?),?),geometry::STGeomFromWKB(CONVERT(VARBINARY(MAX),?),?)," +
+		"geography::STGeomFromWKB(CONVERT(VARBINARY(MAX),?),?))"
+	if actual := buildInsertStatement("testtable", cols); actual != expected {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
+	}
+
+	// WKB & SRID of each spatial column, SRID 0 of geography is replaced
+	expectedValues := []value{1, wkb, int64(4326), wkb, int64(3857), nil, nil}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Errorf("Expected: %v, Actual: %v", expectedValues, values)
+	}
+}
+
+func TestUnsignedColumns(t *testing.T) {
+	big, small := uint64(18446744073709551615), uint64(1)
+	model := &struct {
+		ID     uint32  `gorm:"column:id;primaryKey"`
+		Tiny   uint8   `gorm:"column:tiny"`
+		Small  *uint16 `gorm:"column:small"`
+		Big    uint64  `gorm:"column:big"`
+		NBig   *uint64 `gorm:"column:nbig"`
+		Legacy uint    `gorm:"column:legacy"`
+	}{ID: 4294967295, Tiny: 255, Big: big, NBig: &small}
+
+	cols, values := getColumns(model, false)
+	expected := "create table [testtable] ([id] bigint not null,[tiny] tinyint not null,[small] int null," +
+		"[big] decimal(20,0) not null,[nbig] decimal(20,0) null,[legacy] decimal(21,0) not null,constraint [PK_testtable] primary key ([id]));"
+	if actual := buildCreateTableStatement("testtable", cols); actual != expected {
+		t.Errorf("Expected: \n\n%s\n\n Actual: \n\n%s\n\n", expected, actual)
+	}
+	// values overflowing bigint are sent as decimal
+	if d, ok := values[3].(dcm.Decimal); !ok || d.String() != "18446744073709551615" {
+		t.Errorf("Expected decimal 18446744073709551615, Actual: %#v", values[3])
+	}
+	if values[0] != uint32(4294967295) || values[1] != uint8(255) || values[2] != nil || *values[4].(*uint64) != 1 {
+		t.Errorf("Actual: %v", values)
+	}
+}
+
+func TestTransientErrors(t *testing.T) {
+	errs := map[error]bool{
+		fmt.Errorf("Insert error: %w", mssql.Error{Number: 1205}):    true, // deadlock
+		fmt.Errorf("Commit error: %w", mssql.Error{Number: 40613}):   true, // database unavailable
+		fmt.Errorf("Begin transaction error: %w", driver.ErrBadConn): true,
+		fmt.Errorf("Insert error: %w", mssql.Error{Number: 2627}):    false, // primary key violation
+		fmt.Errorf("Insert error: %w", mssql.Error{Number: 8152}):    false, // string truncated
+		fmt.Errorf("Marshal error"):                                  false,
+	}
+	for err, transient := range errs {
+		if isTransientError(err) != transient {
+			t.Errorf("%v: expected transient %v", err, transient)
+		}
+		// a transient error is never dead-lettered
+		if transient && isRecordError(err) {
+			t.Errorf("%v: expected not a record error", err)
+		}
+	}
+}
+
+// failingDriver is a database/sql driver whose statements fail with SQL Server error number `name`,
+// e.g. sql.Open("failing", "208")
+type failingDriver struct{}
+
+type failingConn struct{ number int32 }
+
+type failingStmt struct{ number int32 }
+
+func (failingDriver) Open(name string) (driver.Conn, error) {
+	var number int32
+	_, err := fmt.Sscan(name, &number)
+	return failingConn{number}, err
+}
+
+func (c failingConn) Prepare(query string) (driver.Stmt, error) { return failingStmt(c), nil }
+func (failingConn) Close() error                                { return nil }
+func (c failingConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (failingConn) Commit() error                               { return nil }
+func (failingConn) Rollback() error                             { return nil }
+
+func (failingStmt) Close() error  { return nil }
+func (failingStmt) NumInput() int { return -1 }
+func (s failingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, mssql.Error{Number: s.number, Message: fmt.Sprintf("error %d", s.number)}
+}
+func (s failingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, mssql.Error{Number: s.number, Message: fmt.Sprintf("error %d", s.number)}
+}
+
+func init() {
+	sql.Register("failing", failingDriver{})
+}
+
+func TestRecordErrors(t *testing.T) {
+	for number, deadLettered := range map[int32]bool{
+		2627: true,  // primary key violation
+		208:  false, // invalid object name, e.g. the target table was dropped
+		207:  false, // invalid column name
+	} {
+		store := &Store{LocalDb: db.UseInmemDB(), Models: ModelDefinitions{"StoreTest": &storeTest{}}}
+		store.LogInsert("StoreTest", &storeTest{1, []byte("order")})
+		s := NewSyncer(TargetDbConfig{}, 1, store)
+		s.db, _ = sql.Open("failing", fmt.Sprint(number))
+
+		s.SyncAllModels(true)
+		if list, _ := store.DeadLetters("StoreTest"); (len(list) == 1) != deadLettered {
+			t.Errorf("%d - Expected dead-lettered: %v, Actual dead letters: %v", number, deadLettered, len(list))
+		}
+		// the syncer stops on errors which are not specific to a record
+		if stopped := s.Status().LastError != ""; stopped == deadLettered {
+			t.Errorf("%d - Expected stopped: %v, Actual last error: %q", number, !deadLettered, s.Status().LastError)
+		}
+		s.Close()
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	s := &Syncer{cfg: TargetDbConfig{RetryInterval: time.Second, MaxRetryInterval: 5 * time.Second}}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, wait := range expected {
+		if actual := s.backoff(i + 1); actual != wait {
+			t.Errorf("attempt %d: expected %v, actual %v", i+1, wait, actual)
+		}
+	}
+
+	s.cfg.RetryJitter = 0.5
+	for i := 0; i < 100; i++ {
+		if wait := s.backoff(2); wait < time.Second || wait > 3*time.Second {
+			t.Errorf("expected between 1s & 3s, actual %v", wait)
+		}
+	}
+}
+
 func TestSyncerInsertTable(t *testing.T) {
 	dec, _ := dcm.NewFromString("11112345111899999999874444444313.11198")
 	dtime, _ := time.Parse("2006-01-02 15:04:05", "2020-01-01 10:10:10")
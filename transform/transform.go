@@ -0,0 +1,125 @@
+// Package transform provides the value transformations applied to the columns of parsed rows before they're logged,
+// see param.Column.Transforms. Custom transformations can be added with `Register`
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transformer transforms the value of a column, `value` has the Go type of its datamodel field
+// (e.g. string, *string, time.Time, *time.Time, see db.Convert) & so must the returned value
+type Transformer interface {
+	Transform(value interface{}) (interface{}, error)
+}
+
+// Func adapts an ordinary function to Transformer
+type Func func(value interface{}) (interface{}, error)
+
+// Transform implements Transformer
+func (f Func) Transform(value interface{}) (interface{}, error) {
+	return f(value)
+}
+
+// Factory creates a Transformer from the options of a transformation (see param.Transform)
+type Factory func(options map[string]string) (Transformer, error)
+
+var (
+	factories = map[string]Factory{
+		"trim":              stringFactory(strings.TrimSpace),
+		"lower":             stringFactory(strings.ToLower),
+		"upper":             stringFactory(strings.ToUpper),
+		"mask_email":        stringFactory(maskEmail),
+		"hash":              newHash,
+		"map":               newMap,
+		"zero_date_to_null": newZeroDateToNull,
+	}
+	factoriesMu sync.RWMutex
+)
+
+// Register adds a custom transformation, it can then be used by `name` in datamodels.
+// Must be called before the datamodels using it are put or loaded, a built-in transformation can be overridden
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// New creates the Transformer of transformation `name`
+func New(name string, options map[string]string) (Transformer, error) {
+	factoriesMu.RLock()
+	factory := factories[name]
+	factoriesMu.RUnlock()
+	if factory == nil {
+		return nil, fmt.Errorf("unknown transformation %v", name)
+	}
+	return factory(options)
+}
+
+// stringFactory creates transformations of string & *string values, a nil value is left as is
+func stringFactory(f func(string) string) Factory {
+	return func(options map[string]string) (Transformer, error) {
+		return Func(func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case string:
+				return f(v), nil
+			case *string:
+				if v == nil {
+					return v, nil
+				}
+				s := f(*v)
+				return &s, nil
+			}
+			return nil, fmt.Errorf("unsupported type %T, expected a String column", value)
+		}), nil
+	}
+}
+
+// maskEmail keeps the first character of the local part & the domain, example: "john@mail.com" => "j***@mail.com"
+func maskEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	if at < 1 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:1] + strings.Repeat("*", at-1) + s[at:]
+}
+
+// newHash replaces a value with the hex encoded SHA-256 of it, prefixed with option "salt"
+func newHash(options map[string]string) (Transformer, error) {
+	salt := options["salt"]
+	return stringFactory(func(s string) string {
+		sum := sha256.Sum256([]byte(salt + s))
+		return hex.EncodeToString(sum[:])
+	})(nil)
+}
+
+// newMap replaces a value found in options by its mapped value (e.g. enum strings to codes), others are left as is
+func newMap(options map[string]string) (Transformer, error) {
+	if len(options) == 0 {
+		return nil, fmt.Errorf("map: options are empty")
+	}
+	return stringFactory(func(s string) string {
+		if mapped, ok := options[s]; ok {
+			return mapped
+		}
+		return s
+	})(nil)
+}
+
+// newZeroDateToNull replaces MySQL zero dates ("0000-00-00", parsed as zero time) with nil, only for NullableDateTime columns
+func newZeroDateToNull(options map[string]string) (Transformer, error) {
+	return Func(func(value interface{}) (interface{}, error) {
+		v, ok := value.(*time.Time)
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %T, expected a NullableDateTime column", value)
+		}
+		if v != nil && v.IsZero() {
+			return (*time.Time)(nil), nil
+		}
+		return v, nil
+	}), nil
+}
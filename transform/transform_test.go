@@ -0,0 +1,93 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func transformed(t *testing.T, name string, options map[string]string, value interface{}) interface{} {
+	tr, err := New(name, options)
+	if err != nil {
+		t.Fatalf("New %v failed: %v", name, err)
+	}
+	v, err := tr.Transform(value)
+	if err != nil {
+		t.Fatalf("%v failed: %v", name, err)
+	}
+	return v
+}
+
+func TestStringTransforms(t *testing.T) {
+	s := "  Hello "
+	if v := transformed(t, "trim", nil, s); v != "Hello" {
+		t.Errorf("trim - Expected: %q, Actual: %q", "Hello", v)
+	}
+	if v := transformed(t, "trim", nil, &s).(*string); *v != "Hello" || s != "  Hello " {
+		t.Errorf("trim - Expected: %q & source unchanged, Actual: %q, %q", "Hello", *v, s)
+	}
+	if v := transformed(t, "upper", nil, (*string)(nil)).(*string); v != nil {
+		t.Errorf("upper - Expected nil to be left as is, Actual: %q", *v)
+	}
+
+	emails := map[string]string{"john@mail.com": "j***@mail.com", "a@b.c": "a@b.c", "nobody": "******"}
+	for email, expected := range emails {
+		if v := transformed(t, "mask_email", nil, email); v != expected {
+			t.Errorf("mask_email %v - Expected: %q, Actual: %q", email, expected, v)
+		}
+	}
+
+	h := transformed(t, "hash", nil, "secret").(string)
+	salted := transformed(t, "hash", map[string]string{"salt": "pepper"}, "secret").(string)
+	if len(h) != 64 || h == salted || strings.Contains(h, "secret") {
+		t.Errorf("hash - Expected 2 different SHA-256, Actual: %v, %v", h, salted)
+	}
+
+	codes := map[string]string{"active": "A", "inactive": "I"}
+	if v := transformed(t, "map", codes, "inactive"); v != "I" {
+		t.Errorf("map - Expected: %q, Actual: %q", "I", v)
+	}
+	if v := transformed(t, "map", codes, "deleted"); v != "deleted" {
+		t.Errorf("map - Expected unmapped value to be left as is, Actual: %q", v)
+	}
+	if _, err := New("map", nil); err == nil {
+		t.Error("map - Expected error on empty options")
+	}
+
+	tr, _ := New("lower", nil)
+	if _, err := tr.Transform(1); err == nil {
+		t.Error("lower - Expected error on non-string value")
+	}
+}
+
+func TestZeroDateToNull(t *testing.T) {
+	zero, now := time.Time{}, time.Now()
+	if v := transformed(t, "zero_date_to_null", nil, &zero).(*time.Time); v != nil {
+		t.Errorf("Expected zero date to be nil, Actual: %v", v)
+	}
+	if v := transformed(t, "zero_date_to_null", nil, &now).(*time.Time); v != &now {
+		t.Errorf("Expected %v, Actual: %v", now, v)
+	}
+	tr, _ := New("zero_date_to_null", nil)
+	if _, err := tr.Transform(zero); err == nil {
+		t.Error("Expected error on non-nullable time")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if _, err := New("unknown", nil); err == nil {
+		t.Fatal("Expected error on unknown transformation")
+	}
+	Register("reverse", func(options map[string]string) (Transformer, error) {
+		return Func(func(value interface{}) (interface{}, error) {
+			r := []rune(value.(string))
+			for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+				r[i], r[j] = r[j], r[i]
+			}
+			return string(r), nil
+		}), nil
+	})
+	if v := transformed(t, "reverse", nil, "abc"); v != "cba" {
+		t.Errorf("Expected: %q, Actual: %q", "cba", v)
+	}
+}